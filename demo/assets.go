@@ -0,0 +1,38 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// assets are the files used by the steps. They are written into the work
+// directory of the session, so that the demo runs from anywhere.
+//
+//go:embed test_data gatekeeper
+var assets embed.FS
+
+// extractAssets writes the assets into dir.
+func extractAssets(dir string) error {
+	return fs.WalkDir(assets, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		content, err := assets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return errors.Wrapf(
+			ioutil.WriteFile(target, content, 0o644), "unable to extract %s", path,
+		)
+	})
+}
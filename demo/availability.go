@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+)
+
+// clusterCheck verifies the cluster once for all the runs.
+var clusterCheck = sync.OnceValue(checkCluster)
+
+// available tells why a run cannot start: a tool it runs is missing, or the
+// cluster it uses is not reachable or not allowed.
+func available(ctx *cli.Context, r *demo.Run) error {
+	// Replaying runs nothing.
+	if ctx.String(demo.FlagReplay) != "" {
+		return nil
+	}
+	self, _ := os.Executable()
+	missing, usesCluster := map[string]bool{}, mutatesCluster(r)
+	for _, command := range r.Commands() {
+		for _, b := range commandBinaries(command, self) {
+			if strings.HasSuffix(b, builtinSuffix) {
+				continue
+			}
+			if _, err := exec.LookPath(b); err != nil {
+				missing[b] = true
+			}
+			usesCluster = usesCluster || b == "kubectl"
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("%s not found in $PATH", strings.Join(sorted(missing), ", "))
+	}
+
+	// The in-process API server is started along with the run.
+	if !usesCluster || ctx.Bool(flagLocalCluster) {
+		return nil
+	}
+	if c := clusterCheck(); !c.ok {
+		return errors.Errorf("no cluster with Kubewarden, %s", c.details)
+	}
+	if !mutatesCluster(r) {
+		return nil
+	}
+	context, cluster, err := currentContext()
+	if err != nil {
+		return errors.Wrap(err, "unable to find out the current kube-context")
+	}
+	allowed, ok, err := contextAllowed(ctx, context, cluster)
+	if err != nil || ok {
+		return err
+	}
+
+	return errors.Errorf(
+		"kube-context %q (cluster %q) is not allowed, allowed: %s",
+		context, cluster, strings.Join(allowed, ", "),
+	)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+)
+
+// tool describes how to find out the version of an external binary, and
+// which is the oldest version known to work with the demo.
+type tool struct {
+	versionArgs []string
+	minVersion  string
+}
+
+var tools = map[string]tool{
+	"bat":     {[]string{"--version"}, "0.15.0"},
+	"jq":      {[]string{"--version"}, "1.6"},
+	"kubectl": {[]string{"version", "--client"}, "1.19.0"},
+	"kwctl":   {[]string{"--version"}, "0.2.0"},
+	"opa":     {[]string{"version"}, "0.30.0"},
+	"tar":     {[]string{"--version"}, "1.0"},
+}
+
+// builtinSuffix marks the tools provided by our own builtin subcommands,
+// used when the real tools are missing.
+const builtinSuffix = " (builtin)"
+
+var versionRegexp = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// check is the result of a single doctor verification.
+type check struct {
+	name    string
+	ok      bool
+	details string
+}
+
+func doctorCommand(d *demo.Demo) *cli.Command {
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "verify that every tool and cluster prerequisite of the runs is available",
+		Action: func(ctx *cli.Context) error {
+			if err := setupLocalCluster(ctx); err != nil {
+				return err
+			}
+			defer cleanupLocalCluster(ctx)
+
+			return doctor(d.Runs())
+		},
+	}
+}
+
+func doctor(runs []*demo.Run) error {
+	self, _ := os.Executable()
+	binaries, files := map[string]bool{}, map[string]bool{}
+	for _, r := range runs {
+		for _, command := range r.Commands() {
+			for _, b := range commandBinaries(command, self) {
+				binaries[b] = true
+			}
+			for _, f := range commandFiles(command) {
+				files[f] = true
+			}
+		}
+	}
+
+	checks := []check{}
+	for _, b := range sorted(binaries) {
+		checks = append(checks, checkBinary(b))
+	}
+	if binaries["kubectl"] {
+		checks = append(checks, checkCluster())
+	}
+	for _, f := range sorted(files) {
+		checks = append(checks, checkFile(f))
+	}
+
+	table := &bytes.Buffer{}
+	w := tabwriter.NewWriter(table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tCHECK\tDETAILS")
+	failed := 0
+	for _, c := range checks {
+		status := "pass"
+		if !c.ok {
+			status = "fail"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, c.name, c.details)
+	}
+	w.Flush()
+
+	// The status is colored after the alignment, tabwriter does not know
+	// about escape sequences.
+	for _, line := range strings.SplitAfter(table.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "pass"):
+			line = color.Green.Sprint("pass") + line[4:]
+		case strings.HasPrefix(line, "fail"):
+			line = color.Red.Sprint("fail") + line[4:]
+		}
+		fmt.Print(line)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+func checkBinary(binary string) check {
+	c := check{name: "binary " + binary}
+	if name := strings.TrimSuffix(binary, builtinSuffix); name != binary {
+		return check{name: "binary " + name, ok: true, details: "builtin subcommand"}
+	}
+
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		c.details = "not found in $PATH"
+		return c
+	}
+	t, ok := tools[binary]
+	if !ok {
+		c.ok, c.details = true, path
+		return c
+	}
+
+	out, err := exec.Command(path, t.versionArgs...).CombinedOutput()
+	if err != nil {
+		c.details = fmt.Sprintf("%s: unable to get version: %v", path, err)
+		return c
+	}
+	version := versionRegexp.FindString(string(out))
+	if version == "" {
+		c.details = fmt.Sprintf("%s: unknown version", path)
+		return c
+	}
+	c.details = fmt.Sprintf("%s %s", path, version)
+	if compareVersions(version, t.minVersion) < 0 {
+		c.details += fmt.Sprintf(", at least %s is required", t.minVersion)
+		return c
+	}
+	c.ok = true
+
+	return c
+}
+
+func checkCluster() check {
+	c := check{name: "cluster clusteradmissionpolicies"}
+	context, _ := exec.Command("kubectl", "config", "current-context").Output()
+	out, err := exec.Command(
+		"kubectl", "get", "clusteradmissionpolicies.policies.kubewarden.io",
+		"--request-timeout=5s", "-o", "name",
+	).CombinedOutput()
+	if err != nil {
+		c.details = fmt.Sprintf(
+			"context %q: %s", strings.TrimSpace(string(context)), lastLine(out),
+		)
+		return c
+	}
+	c.ok = true
+	c.details = fmt.Sprintf("reachable in context %q", strings.TrimSpace(string(context)))
+
+	return c
+}
+
+// checkFile verifies that the file is part of the embedded assets.
+func checkFile(path string) check {
+	c := check{name: "file " + path}
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := fs.Glob(assets, filepath.ToSlash(path))
+		if err != nil || len(matches) == 0 {
+			c.details = "no match in the embedded assets"
+			return c
+		}
+		c.ok = true
+		c.details = fmt.Sprintf("%d files", len(matches))
+		return c
+	}
+	info, err := fs.Stat(assets, filepath.ToSlash(path))
+	if err != nil {
+		c.details = "missing from the embedded assets"
+		return c
+	}
+	c.ok = true
+	c.details = fmt.Sprintf("%d bytes", info.Size())
+
+	return c
+}
+
+// commandBinaries returns the binaries executed by a shell command. Builtin
+// subcommands of self are reported by their name, with builtinSuffix.
+func commandBinaries(command, self string) []string {
+	binaries := []string{}
+	for _, words := range simpleCommands(command) {
+		if words[0] != self {
+			binaries = append(binaries, words[0])
+		} else if len(words) > 1 {
+			// Our own builtin subcommand, named by the next word.
+			binaries = append(binaries, words[1]+builtinSuffix)
+		}
+	}
+
+	return binaries
+}
+
+// simpleCommands splits a shell command into the words of the commands
+// separated by control operators, without the environment variable
+// assignments they start with.
+func simpleCommands(command string) [][]string {
+	commands, words := [][]string{}, []string{}
+	for _, word := range shellWords(command) {
+		switch {
+		case isControlOperator(word):
+			if len(words) > 0 {
+				commands = append(commands, words)
+			}
+			words = []string{}
+		case len(words) == 0 && isAssignment(word):
+		default:
+			words = append(words, word)
+		}
+	}
+	if len(words) > 0 {
+		commands = append(commands, words)
+	}
+
+	return commands
+}
+
+func isAssignment(word string) bool {
+	return strings.Contains(word, "=") && !strings.Contains(word, "/")
+}
+
+// commandFiles returns the demo assets referenced by a shell command.
+func commandFiles(command string) []string {
+	files := []string{}
+	for _, word := range shellWords(command) {
+		for _, dir := range []string{"test_data", "gatekeeper"} {
+			if strings.HasPrefix(filepath.Clean(word), dir+string(filepath.Separator)) {
+				files = append(files, filepath.Clean(word))
+			}
+		}
+	}
+
+	return files
+}
+
+// shellWords splits a shell command into words, honoring quotes. Control
+// operators are returned as words on their own.
+func shellWords(command string) []string {
+	words := []string{}
+	word, inWord := strings.Builder{}, false
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	var quote rune
+	for _, c := range command {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case c == '|' || c == '&' || c == ';':
+			if inWord && !strings.ContainsAny(word.String(), "|&;") {
+				flush()
+			}
+			word.WriteRune(c)
+			inWord = true
+		default:
+			if inWord && strings.ContainsAny(word.String(), "|&;") {
+				flush()
+			}
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	flush()
+
+	return words
+}
+
+// compareVersions compares two dotted versions numerically.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func sorted(set map[string]bool) []string {
+	res := []string{}
+	for k := range set {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func lastLine(b []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/kubewarden"
+)
+
+// evaluateCommand evaluates Kubewarden policy manifests against request
+// fixtures, without a cluster nor the registry.
+func evaluateCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "evaluate",
+		Usage:     "evaluate a ClusterAdmissionPolicy manifest against requests, offline",
+		ArgsUsage: "<request.json>...",
+		Flags: []cli.Flag{
+			&cli.PathFlag{
+				Name:     "policy",
+				Aliases:  []string{"p"},
+				Usage:    "the ClusterAdmissionPolicy manifest",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "print a ValidationResponse per request (json) or a verdict table (table)",
+				Value:   "json",
+			},
+		},
+		Action: evaluate,
+	}
+}
+
+func evaluate(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("at least one request has to be provided")
+	}
+	p, err := kubewarden.Load(ctx.Path("policy"))
+	if err != nil {
+		return err
+	}
+	responses, err := p.Evaluate(context.Background(), ctx.Args().Slice()...)
+	if err != nil {
+		return err
+	}
+
+	switch ctx.String("output") {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range responses {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	case "table":
+		rows := [][]string{{"REQUEST", "VERDICT", "MESSAGE"}}
+		for i, r := range responses {
+			verdict := "accept"
+			if !r.Allowed {
+				verdict = "reject"
+			}
+			rows = append(rows, []string{ctx.Args().Get(i), verdict, r.Message()})
+		}
+		return writeTable(os.Stdout, rows, func(row, column int, cell string) string {
+			switch {
+			case row == 0 || column != 1:
+				return cell
+			case cell == "accept":
+				return color.Green.Sprint(cell)
+			default:
+				return color.Red.Sprint(cell)
+			}
+		})
+	default:
+		return errors.Errorf("unsupported output %q", ctx.String("output"))
+	}
+
+	return nil
+}
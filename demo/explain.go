@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+	"github.com/ereslibre/kubecon-na-21/internal/kubewarden"
+)
+
+func explainCommand(d *demo.Demo) *cli.Command {
+	return &cli.Command{
+		Name:      "explain",
+		Usage:     "explain which policies apply to a request, and why",
+		ArgsUsage: "[manifest.yaml]...",
+		Description: "Without arguments, the policy manifests used by the runs are " +
+			"considered, relative to the current directory.",
+		Flags: []cli.Flag{
+			&cli.PathFlag{
+				Name:     "request",
+				Aliases:  []string{"r"},
+				Usage:    "the AdmissionRequest, or AdmissionReview, to match",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "operation",
+				Usage: "match the request as if it was for this operation, e.g. UPDATE",
+			},
+			&cli.StringSliceFlag{
+				Name:  "namespace-labels",
+				Usage: "labels of the namespace of the request, as key=value, for the namespaceSelectors",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			paths := ctx.Args().Slice()
+			if len(paths) == 0 {
+				for _, r := range d.Runs() {
+					paths = append(paths, policyManifests(r, ".")...)
+				}
+			}
+
+			return explain(ctx, sorted(toSet(paths)))
+		},
+	}
+}
+
+func explain(ctx *cli.Context, paths []string) error {
+	document, err := admission.Load(ctx.Path("request"))
+	if err != nil {
+		return err
+	}
+	request := document.Request
+	if operation := ctx.String("operation"); operation != "" {
+		request.Operation = strings.ToUpper(operation)
+	}
+
+	var namespaceLabels kubewarden.NamespaceLabels
+	if values := ctx.StringSlice("namespace-labels"); len(values) > 0 {
+		labels := map[string]string{}
+		for _, v := range values {
+			kv := strings.SplitN(v, "=", 2)
+			if len(kv) != 2 {
+				return errors.Errorf("invalid namespace label %q, expected key=value", v)
+			}
+			labels[kv[0]] = kv[1]
+		}
+		namespaceLabels = func(string) (map[string]string, bool) { return labels, true }
+	}
+
+	policies := []*kubewarden.Policy{}
+	for _, path := range paths {
+		p, err := kubewarden.Load(path)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, p)
+	}
+
+	rows := [][]string{{"POLICY", "KIND", "MATCH", "REASON"}}
+	for _, m := range kubewarden.MatchAll(policies, request, namespaceLabels) {
+		match := "matched"
+		if !m.Matched {
+			match = "unmatched"
+		}
+		rows = append(rows, []string{m.Policy.Metadata.Name, m.Policy.Kind, match, m.Reason})
+	}
+
+	return writeTable(os.Stdout, rows, func(row, column int, cell string) string {
+		switch {
+		case row == 0 || column != 2:
+			return cell
+		case cell == "matched":
+			return color.Green.Sprint(cell)
+		default:
+			return color.Yellow.Sprint(cell)
+		}
+	})
+}
+
+func toSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
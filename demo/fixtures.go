@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+)
+
+// defaultFixtureSet lists the fixtures generated out of the resources of the
+// demo.
+const defaultFixtureSet = "test_data/fixtures.yaml"
+
+func fixturesCommand() *cli.Command {
+	setFlag := &cli.PathFlag{
+		Name:  "set",
+		Usage: "the file listing the generated fixtures",
+		Value: defaultFixtureSet,
+	}
+
+	return &cli.Command{
+		Name:  "fixtures",
+		Usage: "generate AdmissionRequest fixtures out of resource manifests",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "generate",
+				Usage:     "print the fixture of a resource manifest",
+				ArgsUsage: "<resource.yaml>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "operation",
+						Usage: "the operation of the request: CREATE, UPDATE or DELETE",
+						Value: admission.Create,
+					},
+					&cli.PathFlag{
+						Name:  "old-object",
+						Usage: "the manifest of the object replaced by an UPDATE",
+					},
+					&cli.StringFlag{
+						Name:  "username",
+						Usage: "the user issuing the request",
+						Value: admission.DefaultUserInfo.Username,
+					},
+					&cli.StringSliceFlag{
+						Name:  "groups",
+						Usage: "the groups of the user issuing the request",
+						Value: cli.NewStringSlice(admission.DefaultUserInfo.Groups...),
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "mark the request as a dry run",
+					},
+					&cli.StringFlag{
+						Name:  "uid",
+						Usage: "the uid of the request, derived from the resource by default",
+					},
+					&cli.BoolFlag{
+						Name:  "review",
+						Usage: "wrap the request in an admission.k8s.io/v1 AdmissionReview",
+					},
+					&cli.PathFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "write the fixture to this file instead of stdout",
+					},
+				},
+				Action: generateFixture,
+			},
+			{
+				Name:   "check",
+				Usage:  "verify that the generated fixtures match their resources",
+				Flags:  []cli.Flag{setFlag},
+				Action: checkFixtures,
+			},
+			{
+				Name:   "update",
+				Usage:  "regenerate the fixtures out of their resources",
+				Flags:  []cli.Flag{setFlag},
+				Action: updateFixtures,
+			},
+		},
+	}
+}
+
+func generateFixture(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("exactly one resource manifest has to be provided")
+	}
+	fixture, err := admission.Fixture(ctx.Args().First(), admission.FixtureOptions{
+		Operation: ctx.String("operation"),
+		OldObject: ctx.Path("old-object"),
+		UserInfo: &admission.UserInfo{
+			Username: ctx.String("username"),
+			Groups:   ctx.StringSlice("groups"),
+		},
+		DryRun: ctx.Bool("dry-run"),
+		UID:    ctx.String("uid"),
+		Review: ctx.Bool("review"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if path := ctx.Path("output"); path != "" {
+		return errors.Wrap(ioutil.WriteFile(path, fixture, 0o644), "unable to write fixture")
+	}
+	_, err = os.Stdout.Write(fixture)
+
+	return err
+}
+
+func checkFixtures(ctx *cli.Context) error {
+	set, err := admission.LoadFixtureSet(ctx.Path("set"))
+	if err != nil {
+		return err
+	}
+
+	total, drifted := 0, 0
+	if err := set.Generate(func(path string, fixture []byte) error {
+		total++
+		committed, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "unable to read fixture")
+		}
+		equal, err := admission.Equal(committed, fixture)
+		if err != nil {
+			return errors.Wrapf(err, "invalid fixture %s", path)
+		}
+		if !equal {
+			drifted++
+			fmt.Printf("%s does not match its resource\n", path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if drifted > 0 {
+		return errors.Errorf(
+			"%d of %d fixtures drifted, regenerate them with `fixtures update`",
+			drifted, total,
+		)
+	}
+	fmt.Printf("%d fixtures up to date\n", total)
+
+	return nil
+}
+
+func updateFixtures(ctx *cli.Context) error {
+	set, err := admission.LoadFixtureSet(ctx.Path("set"))
+	if err != nil {
+		return err
+	}
+
+	return set.Generate(func(path string, fixture []byte) error {
+		if committed, err := ioutil.ReadFile(path); err == nil && bytes.Equal(committed, fixture) {
+			return nil
+		}
+		fmt.Printf("updating %s\n", path)
+		return errors.Wrap(ioutil.WriteFile(path, fixture, 0o644), "unable to write fixture")
+	})
+}
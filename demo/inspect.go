@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// runSummary is a run as printed by list.
+type runSummary struct {
+	Index      int    `json:"index"`
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	Usage      string `json:"usage"`
+	Steps      int    `json:"steps"`
+	HasSetup   bool   `json:"setup"`
+	HasCleanup bool   `json:"cleanup"`
+}
+
+// runDetails is a run as printed by show.
+type runDetails struct {
+	Index       int           `json:"index"`
+	Name        string        `json:"name"`
+	Title       string        `json:"title"`
+	Usage       string        `json:"usage"`
+	Description []string      `json:"description,omitempty"`
+	HasSetup    bool          `json:"setup"`
+	HasCleanup  bool          `json:"cleanup"`
+	StepTimeout string        `json:"stepTimeout,omitempty"`
+	Steps       []stepDetails `json:"steps"`
+}
+
+type stepDetails struct {
+	Number  int      `json:"number"`
+	Text    []string `json:"text,omitempty"`
+	Command string   `json:"command,omitempty"`
+	CanFail bool     `json:"canFail,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "the output format: text or json",
+		Value:   formatText,
+	}
+}
+
+func listCommand(d *demo.Demo) *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "list the runs of the demo, without running them",
+		Flags: []cli.Flag{outputFlag()},
+		Action: func(ctx *cli.Context) error {
+			runs := []runSummary{}
+			for _, e := range d.Entries() {
+				runs = append(runs, summarize(e))
+			}
+
+			return printRuns(os.Stdout, ctx.String("output"), runs)
+		},
+	}
+}
+
+func showCommand(d *demo.Demo) *cli.Command {
+	return &cli.Command{
+		Name:      "show",
+		Usage:     "show the steps of a run and the commands they would run, without running them",
+		ArgsUsage: "<run>",
+		Description: "The run is given by its name, the flag selecting it, or by its " +
+			"index, as printed by list. The demo binary is shown as " + selfPlaceholder +
+			" in the commands, which run kwctl and opa when they are installed, like the run does.",
+		Flags: []cli.Flag{outputFlag()},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return errors.New("exactly one run has to be provided")
+			}
+			e, err := lookupRun(d, ctx.Args().First())
+			if err != nil {
+				return err
+			}
+
+			// The run is described again, with the demo binary shown
+			// as selfPlaceholder.
+			if s, ok := runScripts[e.Run]; ok {
+				if e.Run, err = s.Run(displayRuntime); err != nil {
+					return err
+				}
+			}
+
+			return printRun(os.Stdout, ctx.String("output"), details(e))
+		},
+	}
+}
+
+// lookupRun finds a run by its name or index.
+func lookupRun(d *demo.Demo, name string) (demo.Entry, error) {
+	names := []string{}
+	for _, e := range d.Entries() {
+		if e.Name == name || strconv.Itoa(e.Index) == name {
+			return e, nil
+		}
+		names = append(names, e.Name)
+	}
+
+	return demo.Entry{}, errors.Errorf("unknown run %q, runs: %s", name, strings.Join(names, ", "))
+}
+
+func summarize(e demo.Entry) runSummary {
+	return runSummary{
+		Index:      e.Index,
+		Name:       e.Name,
+		Title:      e.Run.Title(),
+		Usage:      e.Usage,
+		Steps:      len(e.Run.Steps()),
+		HasSetup:   e.Run.HasSetup(),
+		HasCleanup: e.Run.HasCleanup(),
+	}
+}
+
+func details(e demo.Entry) runDetails {
+	d := runDetails{
+		Index:       e.Index,
+		Name:        e.Name,
+		Title:       e.Run.Title(),
+		Usage:       e.Usage,
+		Description: e.Run.Description(),
+		HasSetup:    e.Run.HasSetup(),
+		HasCleanup:  e.Run.HasCleanup(),
+		Steps:       []stepDetails{},
+	}
+	if timeout := e.Run.DefaultStepTimeout(); timeout > 0 {
+		d.StepTimeout = timeout.String()
+	}
+	for i, s := range e.Run.Steps() {
+		step := stepDetails{Number: i + 1, Text: s.Text, Command: s.Command, CanFail: s.CanFail}
+		if s.Timeout > 0 && s.Command != "" {
+			step.Timeout = s.Timeout.String()
+		}
+		d.Steps = append(d.Steps, step)
+	}
+
+	return d
+}
+
+func printRuns(w io.Writer, format string, runs []runSummary) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, runs)
+	case formatText:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "INDEX\tNAME\tTITLE\tSTEPS\tSETUP\tCLEANUP")
+		for _, r := range runs {
+			fmt.Fprintf(
+				tw, "%d\t%s\t%s\t%d\t%s\t%s\n",
+				r.Index, r.Name, r.Title, r.Steps, yesNo(r.HasSetup), yesNo(r.HasCleanup),
+			)
+		}
+		return tw.Flush()
+	default:
+		return errors.Errorf("unknown output format %q", format)
+	}
+}
+
+// printRun prints the steps of the run like they are presented, the
+// description of every step followed by its command.
+func printRun(w io.Writer, format string, run runDetails) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, run)
+	case formatText:
+	default:
+		return errors.Errorf("unknown output format %q", format)
+	}
+
+	fmt.Fprintf(w, "%s\n%s\n", run.Title, strings.Repeat("=", len([]rune(run.Title))))
+	fmt.Fprintf(w, "run: %s (%d), setup: %s, cleanup: %s", run.Name, run.Index, yesNo(run.HasSetup), yesNo(run.HasCleanup))
+	if run.StepTimeout != "" {
+		fmt.Fprintf(w, ", step timeout: %s", run.StepTimeout)
+	}
+	fmt.Fprintln(w)
+	for _, line := range run.Description {
+		fmt.Fprintln(w, line)
+	}
+	for _, s := range run.Steps {
+		fmt.Fprintln(w)
+		for i, line := range s.Text {
+			if i == len(s.Text)-1 {
+				line += fmt.Sprintf(" [%d/%d]", s.Number, len(run.Steps))
+			}
+			fmt.Fprintf(w, "# %s\n", line)
+		}
+		if s.Command == "" {
+			continue
+		}
+		notes := []string{}
+		if s.CanFail {
+			notes = append(notes, "can fail")
+		}
+		if s.Timeout != "" {
+			notes = append(notes, "timeout "+s.Timeout)
+		}
+		if len(notes) > 0 {
+			fmt.Fprintf(w, "# (%s)\n", strings.Join(notes, ", "))
+		}
+		_, err := fmt.Fprintf(w, "> %s\n", s.Command)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(v)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -0,0 +1,303 @@
+package admission
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+// FixtureOptions describe the AdmissionRequest generated for a resource.
+type FixtureOptions struct {
+	// Operation is the operation of the request, CREATE by default.
+	Operation string `yaml:"operation"`
+
+	// OldObject is the manifest of the object being replaced by an UPDATE.
+	// It is not needed for DELETE, where the resource itself is the old
+	// object.
+	OldObject string `yaml:"oldObject"`
+
+	// UserInfo is the user issuing the request, kubernetes-admin by
+	// default.
+	UserInfo *UserInfo `yaml:"userInfo"`
+
+	DryRun bool `yaml:"dryRun"`
+
+	// UID is the uid of the request. It is derived from the resource when
+	// it is not set, so that fixtures are reproducible.
+	UID string `yaml:"uid"`
+
+	// Review wraps the request in an AdmissionReview.
+	Review bool `yaml:"review"`
+}
+
+// DefaultUserInfo is the user of the generated requests, unless specified.
+var DefaultUserInfo = UserInfo{
+	Username: "kubernetes-admin",
+	Groups:   []string{"system:masters", "system:authenticated"},
+}
+
+// Fixture generates the AdmissionRequest, or AdmissionReview, JSON fixture for
+// the resource manifest at path.
+func Fixture(path string, opts FixtureOptions) ([]byte, error) {
+	object, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(object, &meta); err != nil {
+		return nil, errors.Wrapf(err, "%s is not a Kubernetes object", path)
+	}
+	if meta.APIVersion == "" || meta.Kind == "" {
+		return nil, errors.Errorf("%s has no apiVersion or kind", path)
+	}
+
+	group, version := "", meta.APIVersion
+	if i := strings.LastIndex(meta.APIVersion, "/"); i >= 0 {
+		group, version = meta.APIVersion[:i], meta.APIVersion[i+1:]
+	}
+	r := &Request{
+		UID:       opts.UID,
+		Kind:      GroupVersionKind{Group: group, Version: version, Kind: meta.Kind},
+		Resource:  GroupVersionResource{Group: group, Version: version, Resource: plural(meta.Kind)},
+		Name:      meta.Metadata.Name,
+		Namespace: meta.Metadata.Namespace,
+		Operation: strings.ToUpper(opts.Operation),
+		UserInfo:  DefaultUserInfo,
+		Object:    object,
+		DryRun:    opts.DryRun,
+	}
+	if r.UID == "" {
+		r.UID = derivedUID(object)
+	}
+	if opts.UserInfo != nil {
+		r.UserInfo = *opts.UserInfo
+	}
+
+	switch r.Operation {
+	case "":
+		r.Operation = Create
+	case Create, Connect:
+	case Update:
+		if opts.OldObject == "" {
+			return nil, errors.New("an UPDATE requires the old object")
+		}
+		if r.OldObject, err = ReadManifest(opts.OldObject); err != nil {
+			return nil, err
+		}
+	case Delete:
+		r.Object, r.OldObject = nil, object
+	default:
+		return nil, errors.Errorf("unsupported operation %q", opts.Operation)
+	}
+	if opts.OldObject != "" && r.Operation != Update {
+		return nil, errors.Errorf("an old object is not expected for %s", r.Operation)
+	}
+
+	var v interface{} = r
+	if opts.Review {
+		v = &Review{APIVersion: reviewAPIVersion, Kind: "AdmissionReview", Request: r}
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode fixture")
+	}
+
+	return append(out, '\n'), nil
+}
+
+// Equal returns whether two JSON documents are semantically the same.
+func Equal(a, b []byte) (bool, error) {
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(va, vb), nil
+}
+
+// ReadManifest reads the single resource of the YAML manifest at path as JSON,
+// keeping the order of its keys.
+func ReadManifest(path string) (json.RawMessage, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read manifest")
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	docs := []*yaml.Node{}
+	for {
+		doc := &yaml.Node{}
+		if err := dec.Decode(doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "invalid manifest %s", path)
+		}
+		// Empty documents, like the one after a trailing ---, are ignored.
+		if len(doc.Content) > 0 && doc.Content[0].Tag != "!!null" {
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) != 1 {
+		return nil, errors.Errorf("%s contains %d resources, expected 1", path, len(docs))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, docs[0]); err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %s", path)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes the YAML node as JSON, mappings keep the order of their
+// keys.
+func writeJSON(w *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return writeJSON(w, n.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(w, n.Alias)
+	case yaml.MappingNode:
+		w.WriteByte('{')
+		for i := 0; i < len(n.Content); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			key, err := json.Marshal(n.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			w.Write(key)
+			w.WriteByte(':')
+			if err := writeJSON(w, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+	case yaml.SequenceNode:
+		w.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeJSON(w, c); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	default:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		scalar, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", n.Line)
+		}
+		w.Write(scalar)
+	}
+
+	return nil
+}
+
+// plural returns the resource name of a kind.
+func plural(kind string) string {
+	resource := strings.ToLower(kind)
+	switch {
+	case strings.HasSuffix(resource, "y") && len(resource) > 1 &&
+		!strings.ContainsRune("aeiou", rune(resource[len(resource)-2])):
+		return strings.TrimSuffix(resource, "y") + "ies"
+	case strings.HasSuffix(resource, "s"), strings.HasSuffix(resource, "x"),
+		strings.HasSuffix(resource, "ch"), strings.HasSuffix(resource, "sh"):
+		return resource + "es"
+	}
+
+	return resource + "s"
+}
+
+// derivedUID returns a UUID, version 5 style, out of the object.
+func derivedUID(object []byte) string {
+	b := sha1.Sum(object) // nolint: gosec
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// FixtureSet lists the fixtures generated out of resource manifests, so that
+// they can be regenerated and checked for drift.
+type FixtureSet struct {
+	Fixtures []struct {
+		// Fixture is the path of the generated fixture.
+		Fixture string `yaml:"fixture"`
+
+		// Resource is the path of the resource manifest.
+		Resource string `yaml:"resource"`
+
+		FixtureOptions `yaml:",inline"`
+	} `yaml:"fixtures"`
+
+	dir string
+}
+
+// LoadFixtureSet reads the fixture set at path. Paths are relative to its
+// directory.
+func LoadFixtureSet(path string) (*FixtureSet, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read fixture set")
+	}
+	s := &FixtureSet{dir: filepath.Dir(path)}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil {
+		return nil, errors.Wrapf(err, "invalid fixture set %s", path)
+	}
+	for i, f := range s.Fixtures {
+		if f.Fixture == "" || f.Resource == "" {
+			return nil, errors.Errorf(
+				"invalid fixture set %s: fixtures[%d] needs a fixture and a resource", path, i,
+			)
+		}
+	}
+
+	return s, nil
+}
+
+// Generate calls fn with the path and the expected contents of every fixture
+// of the set.
+func (s *FixtureSet) Generate(fn func(path string, fixture []byte) error) error {
+	for _, f := range s.Fixtures {
+		opts := f.FixtureOptions
+		if opts.OldObject != "" {
+			opts.OldObject = filepath.Join(s.dir, opts.OldObject)
+		}
+		fixture, err := Fixture(filepath.Join(s.dir, f.Resource), opts)
+		if err != nil {
+			return errors.Wrapf(err, "unable to generate %s", f.Fixture)
+		}
+		if err := fn(filepath.Join(s.dir, f.Fixture), fixture); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
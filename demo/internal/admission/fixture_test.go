@@ -0,0 +1,277 @@
+package admission
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlural(t *testing.T) {
+	for _, tc := range []struct {
+		kind, resource string
+	}{
+		{"Pod", "pods"},
+		{"Deployment", "deployments"},
+		{"Ingress", "ingresses"},
+		{"NetworkPolicy", "networkpolicies"},
+		{"ClusterAdmissionPolicy", "clusteradmissionpolicies"},
+		{"Gateway", "gateways"},
+		{"Key", "keys"},
+		{"Box", "boxes"},
+		{"Patch", "patches"},
+		{"Mesh", "meshes"},
+		{"Y", "ys"},
+	} {
+		if got := plural(tc.kind); got != tc.resource {
+			t.Errorf("plural(%q): expected %q, got %q", tc.kind, tc.resource, got)
+		}
+	}
+}
+
+const podManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: nginx
+  namespace: default
+spec:
+  containers:
+    - name: nginx
+      image: nginx:latest
+`
+
+// writeManifests writes the manifests in a temporary directory, and returns
+// its path.
+func writeManifests(t *testing.T, manifests map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, manifest := range manifests {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(manifest), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := writeManifests(t, map[string]string{
+		"pod.yaml":      podManifest,
+		"trailing.yaml": "---\n" + podManifest + "---\n",
+		"empty.yaml":    "",
+		"two.yaml":      podManifest + "---\n" + podManifest,
+		"invalid.yaml":  "kind: [",
+	})
+	for _, tc := range []struct {
+		name string
+		err  string
+	}{
+		{name: "pod.yaml"},
+		{name: "trailing.yaml"},
+		{name: "empty.yaml", err: "contains 0 resources, expected 1"},
+		{name: "two.yaml", err: "contains 2 resources, expected 1"},
+		{name: "invalid.yaml", err: "invalid manifest"},
+		{name: "missing.yaml", err: "unable to read manifest"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			object, err := ReadManifest(filepath.Join(dir, tc.name))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// The keys keep the order of the manifest.
+			expected := `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"nginx","namespace":"default"},` +
+				`"spec":{"containers":[{"name":"nginx","image":"nginx:latest"}]}}`
+			if string(object) != expected {
+				t.Errorf("expected %s, got %s", expected, object)
+			}
+		})
+	}
+}
+
+func TestFixture(t *testing.T) {
+	dir := writeManifests(t, map[string]string{
+		"pod.yaml":     podManifest,
+		"old-pod.yaml": strings.Replace(podManifest, "nginx:latest", "nginx:1.21", 1),
+		"policy.yaml":  "apiVersion: policies.kubewarden.io/v1alpha2\nkind: ClusterAdmissionPolicy\nmetadata:\n  name: psp\n",
+		"no-kind.yaml": "apiVersion: v1\nmetadata:\n  name: nginx\n",
+	})
+	pod, policy := filepath.Join(dir, "pod.yaml"), filepath.Join(dir, "policy.yaml")
+
+	for _, tc := range []struct {
+		name     string
+		resource string
+		opts     FixtureOptions
+		check    func(t *testing.T, d *Document)
+		err      string
+	}{
+		{
+			name:     "create",
+			resource: pod,
+			check: func(t *testing.T, d *Document) {
+				r := d.Request
+				if r.Operation != Create || r.Name != "nginx" || r.Namespace != "default" {
+					t.Errorf("unexpected request %+v", r)
+				}
+				if r.Kind != (GroupVersionKind{Version: "v1", Kind: "Pod"}) ||
+					r.Resource != (GroupVersionResource{Version: "v1", Resource: "pods"}) {
+					t.Errorf("unexpected kind %+v or resource %+v", r.Kind, r.Resource)
+				}
+				if r.UserInfo.Username != DefaultUserInfo.Username || r.OldObject != nil {
+					t.Errorf("unexpected request %+v", r)
+				}
+			},
+		},
+		{
+			name:     "group",
+			resource: policy,
+			opts:     FixtureOptions{Review: true},
+			check: func(t *testing.T, d *Document) {
+				if d.APIVersion != reviewAPIVersion {
+					t.Errorf("expected an AdmissionReview %s, got %q", reviewAPIVersion, d.APIVersion)
+				}
+				expected := GroupVersionResource{
+					Group: "policies.kubewarden.io", Version: "v1alpha2", Resource: "clusteradmissionpolicies",
+				}
+				if d.Request.Resource != expected {
+					t.Errorf("expected the resource %+v, got %+v", expected, d.Request.Resource)
+				}
+			},
+		},
+		{
+			name:     "update",
+			resource: pod,
+			opts:     FixtureOptions{Operation: "update", OldObject: filepath.Join(dir, "old-pod.yaml")},
+			check: func(t *testing.T, d *Document) {
+				if !strings.Contains(string(d.Request.OldObject), "nginx:1.21") {
+					t.Errorf("expected the old object, got %s", d.Request.OldObject)
+				}
+			},
+		},
+		{
+			name:     "delete",
+			resource: pod,
+			opts:     FixtureOptions{Operation: Delete},
+			check: func(t *testing.T, d *Document) {
+				if d.Request.Object != nil || !strings.Contains(string(d.Request.OldObject), "nginx:latest") {
+					t.Errorf("expected the resource as the old object, got %+v", d.Request)
+				}
+			},
+		},
+		{
+			name:     "user",
+			resource: pod,
+			opts:     FixtureOptions{UserInfo: &UserInfo{Username: "alice"}, UID: "1", DryRun: true},
+			check: func(t *testing.T, d *Document) {
+				if d.Request.UserInfo.Username != "alice" || d.Request.UID != "1" || !d.Request.DryRun {
+					t.Errorf("unexpected request %+v", d.Request)
+				}
+			},
+		},
+		{
+			name:     "update without old object",
+			resource: pod,
+			opts:     FixtureOptions{Operation: Update},
+			err:      "an UPDATE requires the old object",
+		},
+		{
+			name:     "old object without update",
+			resource: pod,
+			opts:     FixtureOptions{OldObject: filepath.Join(dir, "old-pod.yaml")},
+			err:      "an old object is not expected for CREATE",
+		},
+		{
+			name:     "unsupported operation",
+			resource: pod,
+			opts:     FixtureOptions{Operation: "patch"},
+			err:      `unsupported operation "patch"`,
+		},
+		{
+			name:     "no kind",
+			resource: filepath.Join(dir, "no-kind.yaml"),
+			err:      "has no apiVersion or kind",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fixture, err := Fixture(tc.resource, tc.opts)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Generated fixtures are valid requests.
+			d, err := Parse(fixture)
+			if err != nil {
+				t.Fatalf("invalid fixture: %v\n%s", err, fixture)
+			}
+			tc.check(t, d)
+		})
+	}
+}
+
+func TestFixtureIsReproducible(t *testing.T) {
+	dir := writeManifests(t, map[string]string{"pod.yaml": podManifest, "other.yaml": podManifest + "  restartPolicy: Never\n"})
+	uid := func(name string) string {
+		fixture, err := Fixture(filepath.Join(dir, name), FixtureOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r Request
+		if err := json.Unmarshal(fixture, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r.UID
+	}
+
+	if uid("pod.yaml") != uid("pod.yaml") {
+		t.Error("expected the uid derived from the same resource to be the same")
+	}
+	if uid("pod.yaml") == uid("other.yaml") {
+		t.Error("expected the uids derived from different resources to differ")
+	}
+}
+
+func TestFixtureSet(t *testing.T) {
+	dir := writeManifests(t, map[string]string{
+		"pod.yaml":     podManifest,
+		"fixtures.yml": "fixtures:\n  - fixture: requests/pod.json\n    resource: pod.yaml\n    operation: DELETE\n",
+		"unknown.yml":  "fixtures:\n  - fixture: pod.json\n    resource: pod.yaml\n    operatoin: DELETE\n",
+		"partial.yml":  "fixtures:\n  - fixture: pod.json\n",
+	})
+
+	s, err := LoadFixtureSet(filepath.Join(dir, "fixtures.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	generated := map[string]string{}
+	err = s.Generate(func(path string, fixture []byte) error {
+		generated[path] = string(fixture)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fixture, ok := generated[filepath.Join(dir, "requests", "pod.json")]
+	if len(generated) != 1 || !ok || !strings.Contains(fixture, `"operation": "DELETE"`) {
+		t.Errorf("unexpected fixtures %v", generated)
+	}
+
+	for name, expected := range map[string]string{
+		"unknown.yml": "field operatoin not found",
+		"partial.yml": "fixtures[0] needs a fixture and a resource",
+	} {
+		if _, err := LoadFixtureSet(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, expected, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AdmissionReview API versions accepted by Parse.
+var reviewAPIVersions = []string{"admission.k8s.io/v1", "admission.k8s.io/v1beta1"}
+
+// Document is an AdmissionRequest, as it was provided: bare or wrapped in an
+// AdmissionReview.
+type Document struct {
+	// Request is the decoded AdmissionRequest.
+	Request *Request
+
+	// Raw is the JSON of the AdmissionRequest, unwrapped, with any field
+	// not known by Request.
+	Raw json.RawMessage
+
+	// APIVersion is the version of the AdmissionReview the request was
+	// wrapped in. It is empty for bare requests.
+	APIVersion string
+}
+
+// Load reads the AdmissionRequest, or AdmissionReview, at path. Errors are
+// prefixed with the path.
+func Load(path string) (*Document, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read request")
+	}
+	d, err := Parse(raw)
+
+	return d, errors.Wrap(err, path)
+}
+
+// Parse decodes an AdmissionRequest, either bare or wrapped in a v1 or
+// v1beta1 AdmissionReview, and verifies it can be evaluated.
+func Parse(data []byte) (*Document, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("empty document")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, syntaxError(data, err)
+	}
+	if fields == nil {
+		return nil, errors.New("not an AdmissionRequest nor an AdmissionReview: null")
+	}
+
+	d := &Document{Raw: data}
+	prefix := ""
+	var kind string
+	json.Unmarshal(fields["kind"], &kind) // nolint: errcheck
+	switch {
+	case kind == "AdmissionReview":
+		if err := json.Unmarshal(fields["apiVersion"], &d.APIVersion); err != nil ||
+			!contains(reviewAPIVersions, d.APIVersion) {
+			return nil, errors.Errorf(
+				"apiVersion: unsupported AdmissionReview version %s, expected one of %s",
+				fields["apiVersion"], strings.Join(reviewAPIVersions, ", "),
+			)
+		}
+		if isNull(fields["request"]) {
+			return nil, errors.New("request: missing, the AdmissionReview has no request")
+		}
+		d.Raw, prefix = fields["request"], "request."
+	case fields["request"] != nil:
+		return nil, errors.New(
+			"apiVersion, kind: missing, the request is not wrapped in an AdmissionReview",
+		)
+	case kind != "":
+		// A bare request has an object as kind, not a string.
+		return nil, errors.Errorf(
+			"not an AdmissionRequest nor an AdmissionReview: found an object of kind %s", kind,
+		)
+	}
+
+	d.Request = &Request{}
+	if err := json.Unmarshal(d.Raw, d.Request); err != nil {
+		return nil, errors.Wrapf(err, "%sinvalid AdmissionRequest", prefix)
+	}
+
+	return d, d.validate(prefix)
+}
+
+func (d *Document) validate(prefix string) error {
+	r := d.Request
+	if r.UID == "" {
+		return errors.Errorf("%suid: missing", prefix)
+	}
+	if r.Kind.Kind == "" || r.Kind.Version == "" {
+		return errors.Errorf("%skind: missing kind or version", prefix)
+	}
+	if r.Resource.Resource == "" || r.Resource.Version == "" {
+		return errors.Errorf("%sresource: missing resource or version", prefix)
+	}
+	switch r.Operation {
+	case "":
+		return errors.Errorf("%soperation: missing", prefix)
+	case Create, Update, Connect:
+		if isNull(r.Object) {
+			return errors.Errorf("%sobject: missing for %s", prefix, r.Operation)
+		}
+	case Delete:
+		if isNull(r.OldObject) {
+			return errors.Errorf("%soldObject: missing for %s", prefix, r.Operation)
+		}
+	default:
+		return errors.Errorf(
+			"%soperation: unsupported %q, expected one of %s",
+			prefix, r.Operation, strings.Join([]string{Create, Update, Delete, Connect}, ", "),
+		)
+	}
+	if r.Operation == Update && isNull(r.OldObject) {
+		return errors.Errorf("%soldObject: missing for %s", prefix, r.Operation)
+	}
+
+	return nil
+}
+
+// syntaxError reports the line and column of JSON syntax errors.
+func syntaxError(data []byte, err error) error {
+	var syntax *json.SyntaxError
+	if !errors.As(err, &syntax) {
+		return errors.Wrap(err, "not an AdmissionRequest nor an AdmissionReview")
+	}
+	before := data[:syntax.Offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n') - 1
+
+	return errors.Errorf("line %d, column %d: %v", line, col, err)
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(bytes.TrimSpace(raw)) == "null"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package admission
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bareRequest = `{
+  "uid": "1299d386-525b-4032-98ae-1949f69f9cfc",
+  "kind": {"group": "", "version": "v1", "kind": "Pod"},
+  "resource": {"group": "", "version": "v1", "resource": "pods"},
+  "name": "nginx",
+  "namespace": "default",
+  "operation": "CREATE",
+  "userInfo": {"username": "kubernetes-admin"},
+  "object": {"apiVersion": "v1", "kind": "Pod"}
+}`
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		document   string
+		apiVersion string
+	}{
+		{
+			name:     "bare request",
+			document: bareRequest,
+		},
+		{
+			name:       "v1 review",
+			document:   `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview", "request": ` + bareRequest + `}`,
+			apiVersion: "admission.k8s.io/v1",
+		},
+		{
+			name:       "v1beta1 review",
+			document:   `{"apiVersion": "admission.k8s.io/v1beta1", "kind": "AdmissionReview", "request": ` + bareRequest + `}`,
+			apiVersion: "admission.k8s.io/v1beta1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := Parse([]byte(tc.document))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if d.APIVersion != tc.apiVersion {
+				t.Errorf("expected the API version %q, got %q", tc.apiVersion, d.APIVersion)
+			}
+			if d.Request.Name != "nginx" || d.Request.Operation != Create || d.Request.Resource.Resource != "pods" {
+				t.Errorf("unexpected request %+v", d.Request)
+			}
+			if !strings.HasPrefix(strings.TrimSpace(string(d.Raw)), `{
+  "uid"`) {
+				t.Errorf("expected the raw request to be unwrapped, got %s", d.Raw)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	// without returns the bare request without the field.
+	without := func(field string) string {
+		var request map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(bareRequest), &request); err != nil {
+			t.Fatal(err)
+		}
+		delete(request, field)
+		raw, err := json.Marshal(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(raw)
+	}
+	review := func(request string) string {
+		return `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview", "request": ` + request + `}`
+	}
+
+	for _, tc := range []struct {
+		name     string
+		document string
+		err      string
+	}{
+		{
+			name:     "empty",
+			document: " \n",
+			err:      "empty document",
+		},
+		{
+			name:     "null",
+			document: "null",
+			err:      "not an AdmissionRequest nor an AdmissionReview: null",
+		},
+		{
+			name:     "syntax error",
+			document: "{\n  \"uid\": \"1\",\n  \"kind\" {}\n}",
+			err:      "line 3, column 10: invalid character '{' after object key",
+		},
+		{
+			name:     "other object",
+			document: `{"apiVersion": "v1", "kind": "Pod"}`,
+			err:      "not an AdmissionRequest nor an AdmissionReview: found an object of kind Pod",
+		},
+		{
+			name:     "unsupported review version",
+			document: `{"apiVersion": "admission.k8s.io/v2", "kind": "AdmissionReview", "request": ` + bareRequest + `}`,
+			err:      `apiVersion: unsupported AdmissionReview version "admission.k8s.io/v2"`,
+		},
+		{
+			name:     "review without request",
+			document: `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`,
+			err:      "request: missing, the AdmissionReview has no request",
+		},
+		{
+			name:     "request not wrapped",
+			document: `{"request": ` + bareRequest + `}`,
+			err:      "apiVersion, kind: missing, the request is not wrapped in an AdmissionReview",
+		},
+		{
+			name:     "missing uid",
+			document: without("uid"),
+			err:      "uid: missing",
+		},
+		{
+			name:     "missing kind",
+			document: review(without("kind")),
+			err:      "request.kind: missing kind or version",
+		},
+		{
+			name:     "missing resource",
+			document: without("resource"),
+			err:      "resource: missing resource or version",
+		},
+		{
+			name:     "missing operation",
+			document: without("operation"),
+			err:      "operation: missing",
+		},
+		{
+			name:     "unsupported operation",
+			document: strings.Replace(bareRequest, "CREATE", "PATCH", 1),
+			err:      `operation: unsupported "PATCH", expected one of CREATE, UPDATE, DELETE, CONNECT`,
+		},
+		{
+			name:     "missing object",
+			document: review(without("object")),
+			err:      "request.object: missing for CREATE",
+		},
+		{
+			name:     "missing old object",
+			document: strings.Replace(bareRequest, "CREATE", "UPDATE", 1),
+			err:      "oldObject: missing for UPDATE",
+		},
+		{
+			name:     "delete without old object",
+			document: strings.Replace(without("object"), "CREATE", "DELETE", 1),
+			err:      "oldObject: missing for DELETE",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.document))
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tc.err)
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %q", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "request.json")
+	if err := os.WriteFile(path, []byte(`{"uid": "1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	if expected := path + ": kind: missing kind or version"; err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
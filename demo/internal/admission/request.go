@@ -0,0 +1,59 @@
+// Package admission loads the AdmissionRequests evaluated by the policies,
+// bare or wrapped in AdmissionReviews, and generates them out of resource
+// manifests.
+package admission
+
+import "encoding/json"
+
+// Review is an admission.k8s.io AdmissionReview.
+type Review struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Request    *Request `json:"request"`
+}
+
+// Request is an admission.k8s.io AdmissionRequest.
+type Request struct {
+	UID         string               `json:"uid"`
+	Kind        GroupVersionKind     `json:"kind"`
+	Resource    GroupVersionResource `json:"resource"`
+	SubResource string               `json:"subResource,omitempty"`
+	Name        string               `json:"name,omitempty"`
+	Namespace   string               `json:"namespace,omitempty"`
+	Operation   string               `json:"operation"`
+	UserInfo    UserInfo             `json:"userInfo"`
+	Object      json.RawMessage      `json:"object,omitempty"`
+	OldObject   json.RawMessage      `json:"oldObject,omitempty"`
+	DryRun      bool                 `json:"dryRun"`
+}
+
+// GroupVersionKind identifies the kind of an object.
+type GroupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// GroupVersionResource identifies the resource of an object.
+type GroupVersionResource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+}
+
+// UserInfo describes the user issuing the request.
+type UserInfo struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Operations of an AdmissionRequest.
+const (
+	Create  = "CREATE"
+	Update  = "UPDATE"
+	Delete  = "DELETE"
+	Connect = "CONNECT"
+)
+
+// The AdmissionReview API version generated fixtures are wrapped with.
+const reviewAPIVersion = "admission.k8s.io/v1"
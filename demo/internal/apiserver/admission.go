@@ -0,0 +1,209 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/kubewarden"
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+// reconcileDelay simulates the time the Kubewarden controller takes to roll
+// out a policy into the policy server.
+const reconcileDelay = 2 * time.Second
+
+const conditionReconciled = "PolicyServerWebhookConfigurationReconciled"
+
+// admissionError is the rejection of a request by a policy.
+type admissionError struct {
+	webhook, message string
+}
+
+func (e *admissionError) Error() string {
+	return fmt.Sprintf("admission webhook %q denied the request: %s", e.webhook, e.message)
+}
+
+// clusterAdmissionPolicy is a ClusterAdmissionPolicy along with its status.
+type clusterAdmissionPolicy struct {
+	kubewarden.Policy
+	Status struct {
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+type validator func(request json.RawMessage) (*policy.ValidationResponse, error)
+
+// validatorFor returns the native implementation of the policy module.
+func validatorFor(module string, settings json.RawMessage) (validator, error) {
+	if strings.HasPrefix(module, policy.SafeAnnotationsModule) {
+		p, err := policy.NewSafeAnnotations(settings)
+		if err != nil {
+			return nil, err
+		}
+		return p.Validate, nil
+	}
+
+	return nil, errors.Errorf("policy module %s is not available offline", module)
+}
+
+func decodePolicy(obj object) (*clusterAdmissionPolicy, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	p := &clusterAdmissionPolicy{}
+
+	return p, errors.Wrap(json.Unmarshal(raw, p), "invalid ClusterAdmissionPolicy")
+}
+
+func (p *clusterAdmissionPolicy) active() bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == conditionReconciled {
+			return c.Status == "True"
+		}
+	}
+
+	return false
+}
+
+// namespaceLabels returns the labels of a stored namespace. Must be called
+// with the lock held.
+func (s *Server) namespaceLabels(namespace string) (map[string]string, bool) {
+	obj, ok := s.objects[namespaces][key("", namespace)]
+	if !ok {
+		return nil, false
+	}
+
+	return labels(obj), true
+}
+
+// admit evaluates the active policies matching the request. Must be called
+// with the lock held.
+func (s *Server) admit(req *request, operation string, obj, old object) error {
+	policies := s.list(clusterAdmissionPolicies, "", selectors{})
+	if len(policies) == 0 {
+		return nil
+	}
+
+	name := req.name
+	if obj != nil {
+		name = metaString(obj, "name")
+	}
+	request := &admission.Request{
+		UID: uuid(),
+		Kind: admission.GroupVersionKind{
+			Group:   req.resource.group,
+			Version: req.resource.version,
+			Kind:    req.resource.kind,
+		},
+		Resource: admission.GroupVersionResource{
+			Group:    req.resource.group,
+			Version:  req.resource.version,
+			Resource: req.resource.name,
+		},
+		SubResource: req.subresource,
+		Name:        name,
+		Namespace:   req.namespace,
+		Operation:   operation,
+		UserInfo:    admission.DefaultUserInfo,
+		DryRun:      req.dryRun,
+	}
+	var err error
+	if obj != nil {
+		if request.Object, err = json.Marshal(obj); err != nil {
+			return err
+		}
+	}
+	if old != nil {
+		if request.OldObject, err = json.Marshal(old); err != nil {
+			return err
+		}
+	}
+	review, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		cp, err := decodePolicy(p)
+		if err != nil || !cp.active() || !cp.Match(request, s.namespaceLabels).Matched {
+			continue
+		}
+		validate, err := validatorFor(cp.Spec.Module, cp.Spec.Settings)
+		if err != nil {
+			return err
+		}
+		response, err := validate(review)
+		if err != nil {
+			return errors.Wrapf(err, "policy %s failed", cp.Metadata.Name)
+		}
+		if !response.Allowed {
+			return &admissionError{
+				webhook: cp.Metadata.Name + ".kubewarden.admission",
+				message: response.Message(),
+			}
+		}
+	}
+
+	return nil
+}
+
+// reconcileLater marks the policy as active after a while, as long as its
+// module can be evaluated.
+func (s *Server) reconcileLater(obj object) {
+	uid := metaString(obj, "uid")
+	name := metaString(obj, "name")
+	time.AfterFunc(reconcileDelay, func() {
+		s.Lock()
+		defer s.Unlock()
+
+		current, ok := s.objects[clusterAdmissionPolicies][key("", name)]
+		if !ok || metaString(current, "uid") != uid {
+			return
+		}
+		cp, err := decodePolicy(current)
+		if err == nil {
+			_, err = validatorFor(cp.Spec.Module, cp.Spec.Settings)
+		}
+
+		status, message := "True", ""
+		policyStatus := "active"
+		if err != nil {
+			status, message = "False", err.Error()
+			policyStatus = "unschedulable"
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		conditions := []interface{}{}
+		for _, t := range []string{"PolicyActive", conditionReconciled} {
+			conditions = append(conditions, map[string]interface{}{
+				"type":               t,
+				"status":             status,
+				"message":            message,
+				"lastTransitionTime": now,
+			})
+		}
+		updated := deepCopy(current)
+		updated["status"] = map[string]interface{}{
+			"policyStatus": policyStatus,
+			"conditions":   conditions,
+		}
+		s.store(clusterAdmissionPolicies, updated, "MODIFIED")
+	})
+}
+
+func writeAdmissionError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*admissionError); ok {
+		writeStatus(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	writeStatus(w, http.StatusInternalServerError, "InternalError", err.Error())
+}
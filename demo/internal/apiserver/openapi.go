@@ -0,0 +1,70 @@
+package apiserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// serveOpenAPI answers the OpenAPI v3 endpoints. kubectl only looks at them to
+// learn that the server validates the objects itself, so that it does not try
+// to download the complete schemas for client side validation. It returns
+// false when path is not one of them.
+func (s *Server) serveOpenAPI(w http.ResponseWriter, path string) bool {
+	const prefix = "/openapi/v3"
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	if path == prefix {
+		paths := map[string]interface{}{}
+		for _, r := range resources {
+			paths[r.groupVersionPath()] = map[string]string{
+				"serverRelativeURL": prefix + "/" + r.groupVersionPath(),
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"paths": paths})
+		return true
+	}
+
+	paths := map[string]interface{}{}
+	for _, r := range resources {
+		if prefix+"/"+r.groupVersionPath() != path {
+			continue
+		}
+		item := "/" + r.groupVersionPath()
+		if r.namespaced {
+			item += "/namespaces/{namespace}"
+		}
+		item += "/" + r.name + "/{name}"
+		paths[item] = map[string]interface{}{
+			"patch": map[string]interface{}{
+				"x-kubernetes-group-version-kind": map[string]string{
+					"group":   r.group,
+					"version": r.version,
+					"kind":    r.kind,
+				},
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name":   "fieldValidation",
+						"in":     "query",
+						"schema": map[string]string{"type": "string"},
+					},
+				},
+			},
+		}
+	}
+	if len(paths) == 0 {
+		writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return true
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]string{
+			"title":   "Kubernetes",
+			"version": "v1.22.0",
+		},
+		"paths": paths,
+	})
+
+	return true
+}
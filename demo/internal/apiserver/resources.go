@@ -0,0 +1,152 @@
+package apiserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// resource is a kind of object served by the Server.
+type resource struct {
+	group, version, name, kind string
+	namespaced                 bool
+	shortNames                 []string
+}
+
+var (
+	namespaces = &resource{
+		version:    "v1",
+		name:       "namespaces",
+		kind:       "Namespace",
+		shortNames: []string{"ns"},
+	}
+	ingresses = &resource{
+		group:      "networking.k8s.io",
+		version:    "v1",
+		name:       "ingresses",
+		kind:       "Ingress",
+		namespaced: true,
+		shortNames: []string{"ing"},
+	}
+	clusterAdmissionPolicies = &resource{
+		group:   "policies.kubewarden.io",
+		version: "v1alpha2",
+		name:    "clusteradmissionpolicies",
+		kind:    "ClusterAdmissionPolicy",
+	}
+
+	resources = []*resource{namespaces, ingresses, clusterAdmissionPolicies}
+)
+
+var verbs = []string{
+	"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch",
+}
+
+func (r *resource) apiVersion() string {
+	if r.group == "" {
+		return r.version
+	}
+
+	return r.group + "/" + r.version
+}
+
+// groupVersionPath returns the path of the group version, relative to the root
+// of the API.
+func (r *resource) groupVersionPath() string {
+	if r.group == "" {
+		return "api/" + r.version
+	}
+
+	return "apis/" + r.apiVersion()
+}
+
+func (r *resource) String() string {
+	if r.group == "" {
+		return r.name
+	}
+
+	return r.name + "." + r.group
+}
+
+func lookupResource(group, version, name string) *resource {
+	for _, r := range resources {
+		if r.group == group && r.version == version && r.name == name {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// serveDiscovery answers the discovery endpoints used by kubectl to map kinds
+// and short names to resources. It returns false when path is not one of them.
+func (s *Server) serveDiscovery(w http.ResponseWriter, path string) bool {
+	switch {
+	case path == "/version":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"major":      "1",
+			"minor":      "22",
+			"gitVersion": "v1.22.0-kubecon-na-21",
+			"platform":   "linux/amd64",
+		})
+	case path == "/api":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":     "APIVersions",
+			"versions": []string{"v1"},
+			"serverAddressByClientCIDRs": []map[string]string{{
+				"clientCIDR":    "0.0.0.0/0",
+				"serverAddress": s.listener.Addr().String(),
+			}},
+		})
+	case path == "/apis":
+		groups := []interface{}{}
+		for _, r := range resources {
+			if r.group == "" {
+				continue
+			}
+			version := map[string]string{
+				"groupVersion": r.apiVersion(),
+				"version":      r.version,
+			}
+			groups = append(groups, map[string]interface{}{
+				"name":             r.group,
+				"versions":         []interface{}{version},
+				"preferredVersion": version,
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":       "APIGroupList",
+			"apiVersion": "v1",
+			"groups":     groups,
+		})
+	case path == "/api/v1" || strings.Count(path, "/") == 3 && strings.HasPrefix(path, "/apis/"):
+		groupVersion := strings.TrimPrefix(strings.TrimPrefix(path, "/api/"), "/apis/")
+		list := []interface{}{}
+		for _, r := range resources {
+			if r.apiVersion() != groupVersion {
+				continue
+			}
+			list = append(list, map[string]interface{}{
+				"name":         r.name,
+				"singularName": strings.ToLower(r.kind),
+				"namespaced":   r.namespaced,
+				"kind":         r.kind,
+				"verbs":        verbs,
+				"shortNames":   r.shortNames,
+			})
+		}
+		if len(list) == 0 {
+			writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+			return true
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":         "APIResourceList",
+			"apiVersion":   "v1",
+			"groupVersion": groupVersion,
+			"resources":    list,
+		})
+	default:
+		return false
+	}
+
+	return true
+}
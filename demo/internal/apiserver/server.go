@@ -0,0 +1,556 @@
+// Package apiserver implements an in-process stand-in for a Kubernetes API
+// server with Kubewarden installed, good enough for the kubectl commands used
+// by the demo.
+//
+// It serves namespaces, Ingresses and ClusterAdmissionPolicies, reconciles the
+// policies as the Kubewarden controller would, and evaluates them on admission.
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+)
+
+// Name is the name of the cluster, context and user of the kubeconfig.
+const Name = "kubecon-na-21-local"
+
+// Server is a fake Kubernetes API server.
+type Server struct {
+	sync.Mutex
+	listener        net.Listener
+	server          *http.Server
+	objects         map[*resource]map[string]object
+	resourceVersion int
+	watchers        []*watcher
+	dir             string
+}
+
+// Start creates a new Server listening on a random local port.
+func Start() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to listen")
+	}
+	s := &Server{
+		listener: listener,
+		objects:  map[*resource]map[string]object{},
+	}
+	for _, r := range resources {
+		s.objects[r] = map[string]object{}
+	}
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener) // nolint: errcheck
+
+	return s, nil
+}
+
+// URL returns the address of the server.
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// Kubeconfig writes a kubeconfig pointing to the server into a temporary
+// directory and returns its path. The file is removed on Close.
+func (s *Server) Kubeconfig() (string, error) {
+	if s.dir == "" {
+		dir, err := ioutil.TempDir("", "kubecon-na-21-")
+		if err != nil {
+			return "", errors.Wrap(err, "unable to create kubeconfig directory")
+		}
+		s.dir = dir
+	}
+	path := filepath.Join(s.dir, "kubeconfig")
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: %[2]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+current-context: %[1]s
+users:
+- name: %[1]s
+  user: {}
+`, Name, s.URL())
+
+	return path, errors.Wrap(
+		ioutil.WriteFile(path, []byte(kubeconfig), 0o600),
+		"unable to write kubeconfig",
+	)
+}
+
+// Close stops the server and removes the generated kubeconfig.
+func (s *Server) Close() error {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+
+	return s.server.Close()
+}
+
+// request is a parsed API request.
+type request struct {
+	resource    *resource
+	namespace   string
+	name        string
+	subresource string
+	selectors   selectors
+	dryRun      bool
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if r.Method == http.MethodGet && (s.serveDiscovery(w, path) || s.serveOpenAPI(w, path)) {
+		return
+	}
+
+	req, err := parseRequest(r)
+	if err != nil {
+		writeStatus(w, http.StatusNotFound, "NotFound", err.Error())
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && req.name != "":
+		s.get(w, req)
+	case r.Method == http.MethodGet && isWatch(r):
+		s.watch(w, r, req)
+	case r.Method == http.MethodGet:
+		s.listObjects(w, req)
+	case r.Method == http.MethodPost && req.name == "":
+		s.create(w, r, req)
+	case r.Method == http.MethodPut && req.name != "":
+		s.update(w, r, req)
+	case r.Method == http.MethodPatch && req.name != "":
+		s.patch(w, r, req)
+	case r.Method == http.MethodDelete && req.name != "":
+		s.delete(w, req)
+	case r.Method == http.MethodDelete:
+		s.deleteCollection(w, req)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed",
+			fmt.Sprintf("%s is not supported on %s", r.Method, r.URL.Path))
+	}
+}
+
+func parseRequest(r *http.Request) (*request, error) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var group, version string
+	switch {
+	case len(segments) >= 3 && segments[0] == "api":
+		version, segments = segments[1], segments[2:]
+	case len(segments) >= 4 && segments[0] == "apis":
+		group, version, segments = segments[1], segments[2], segments[3:]
+	default:
+		return nil, errors.Errorf("the server could not find the requested resource")
+	}
+
+	req := &request{}
+	if len(segments) >= 3 && segments[0] == "namespaces" &&
+		lookupResource(group, version, segments[2]) != nil {
+		req.namespace, segments = segments[1], segments[2:]
+	}
+	req.resource = lookupResource(group, version, segments[0])
+	if req.resource == nil || len(segments) > 3 {
+		return nil, errors.Errorf("the server could not find the requested resource")
+	}
+	if len(segments) > 1 {
+		req.name = segments[1]
+	}
+	if len(segments) > 2 {
+		req.subresource = segments[2]
+	}
+
+	query := r.URL.Query()
+	req.selectors = selectors{
+		labels: parseSelector(query.Get("labelSelector")),
+		fields: parseSelector(query.Get("fieldSelector")),
+	}
+	req.dryRun = query.Get("dryRun") == "All"
+
+	return req, nil
+}
+
+func isWatch(r *http.Request) bool {
+	w := r.URL.Query().Get("watch")
+
+	return w == "true" || w == "1"
+}
+
+func (s *Server) get(w http.ResponseWriter, req *request) {
+	s.Lock()
+	defer s.Unlock()
+
+	obj, ok := s.objects[req.resource][key(req.namespace, req.name)]
+	if !ok {
+		writeNotFound(w, req)
+		return
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, req *request) {
+	s.Lock()
+	defer s.Unlock()
+
+	writeJSON(w, http.StatusOK, s.listResponse(req))
+}
+
+func (s *Server) listResponse(req *request) object {
+	items := []interface{}{}
+	for _, obj := range s.list(req.resource, req.namespace, req.selectors) {
+		items = append(items, obj)
+	}
+
+	return object{
+		"kind":       req.resource.kind + "List",
+		"apiVersion": req.resource.apiVersion(),
+		"metadata": map[string]interface{}{
+			"resourceVersion": fmt.Sprint(s.resourceVersion),
+		},
+		"items": items,
+	}
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, req *request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeStatus(w, http.StatusInternalServerError, "InternalError", "streaming unsupported")
+		return
+	}
+
+	watcher := &watcher{
+		resource:  req.resource,
+		namespace: req.namespace,
+		selectors: req.selectors,
+		events:    make(chan event, 100),
+	}
+	s.addWatcher(watcher)
+	defer s.removeWatcher(watcher)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+
+	// Clients not providing a resource version expect the current state first.
+	if r.URL.Query().Get("resourceVersion") == "" {
+		s.Lock()
+		for _, obj := range s.list(req.resource, req.namespace, req.selectors) {
+			if err := enc.Encode(event{Type: "ADDED", Object: obj}); err != nil {
+				s.Unlock()
+				return
+			}
+		}
+		s.Unlock()
+		flusher.Flush()
+	}
+
+	timeout := time.After(5 * time.Minute)
+	for {
+		select {
+		case e := <-watcher.events:
+			s.Lock()
+			err := enc.Encode(e)
+			s.Unlock()
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request, req *request) {
+	obj, err := decodeObject(r)
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	meta := metadata(obj)
+	name := metaString(obj, "name")
+	if name == "" {
+		writeStatus(w, http.StatusUnprocessableEntity, "Invalid", "metadata.name: Required value")
+		return
+	}
+	if req.resource.namespaced {
+		if ns := metaString(obj, "namespace"); ns != "" && ns != req.namespace {
+			writeStatus(w, http.StatusBadRequest, "BadRequest",
+				"the namespace of the provided object does not match the namespace sent on the request")
+			return
+		}
+		meta["namespace"] = req.namespace
+		if _, ok := s.objects[namespaces][key("", req.namespace)]; !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound",
+				fmt.Sprintf("namespaces %q not found", req.namespace))
+			return
+		}
+	} else {
+		delete(meta, "namespace")
+	}
+	req.name = name
+	if _, ok := s.objects[req.resource][key(req.namespace, name)]; ok {
+		writeStatus(w, http.StatusConflict, "AlreadyExists",
+			fmt.Sprintf("%s %q already exists", req.resource, name))
+		return
+	}
+
+	if err := s.admit(req, admission.Create, obj, nil); err != nil {
+		writeAdmissionError(w, err)
+		return
+	}
+	if req.dryRun {
+		writeJSON(w, http.StatusCreated, obj)
+		return
+	}
+	if req.resource == namespaces {
+		obj["status"] = map[string]interface{}{"phase": "Active"}
+	}
+	s.store(req.resource, obj, "ADDED")
+	if req.resource == clusterAdmissionPolicies {
+		s.reconcileLater(obj)
+	}
+	writeJSON(w, http.StatusCreated, obj)
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, req *request) {
+	obj, err := decodeObject(r)
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.objects[req.resource][key(req.namespace, req.name)]
+	if !ok {
+		writeNotFound(w, req)
+		return
+	}
+	s.replace(w, req, old, obj)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, req *request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	var patch interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "merge-patch") {
+		writeStatus(w, http.StatusUnsupportedMediaType, "UnsupportedMediaType",
+			fmt.Sprintf("the body of the request was in an unsupported format: %s", contentType))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.objects[req.resource][key(req.namespace, req.name)]
+	if !ok {
+		writeNotFound(w, req)
+		return
+	}
+	// Strategic merge patches are applied as JSON merge patches, which is
+	// enough for the objects served here.
+	patched, _ := mergePatch(deepCopy(old), patch).(map[string]interface{})
+	s.replace(w, req, old, patched)
+}
+
+// replace stores obj as the new version of old. Must be called with the lock
+// held.
+func (s *Server) replace(w http.ResponseWriter, req *request, old, obj object) {
+	if obj == nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", "object expected")
+		return
+	}
+	if req.subresource == "status" {
+		status := obj["status"]
+		obj = deepCopy(old)
+		obj["status"] = status
+	} else {
+		obj["status"] = old["status"]
+	}
+	meta := metadata(obj)
+	oldMeta := metadata(old)
+	for _, field := range []string{"name", "namespace", "uid", "creationTimestamp", "generation"} {
+		if v, ok := oldMeta[field]; ok {
+			meta[field] = v
+		} else {
+			delete(meta, field)
+		}
+	}
+
+	if err := s.admit(req, admission.Update, obj, old); err != nil {
+		writeAdmissionError(w, err)
+		return
+	}
+	if !req.dryRun {
+		s.store(req.resource, obj, "MODIFIED")
+		if req.resource == clusterAdmissionPolicies && req.subresource == "" {
+			s.reconcileLater(obj)
+		}
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func (s *Server) delete(w http.ResponseWriter, req *request) {
+	s.Lock()
+	defer s.Unlock()
+
+	obj, ok := s.objects[req.resource][key(req.namespace, req.name)]
+	if !ok {
+		writeNotFound(w, req)
+		return
+	}
+	if err := s.admit(req, admission.Delete, nil, obj); err != nil {
+		writeAdmissionError(w, err)
+		return
+	}
+	if !req.dryRun {
+		s.remove(req.resource, obj)
+	}
+	writeJSON(w, http.StatusOK, successStatus(req.resource, req.name))
+}
+
+func (s *Server) deleteCollection(w http.ResponseWriter, req *request) {
+	s.Lock()
+	defer s.Unlock()
+
+	response := s.listResponse(req)
+	for _, obj := range s.list(req.resource, req.namespace, req.selectors) {
+		if err := s.admit(req, admission.Delete, nil, obj); err != nil {
+			writeAdmissionError(w, err)
+			return
+		}
+		if !req.dryRun {
+			s.remove(req.resource, obj)
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// remove deletes the object, and all the objects within it in case of a
+// namespace. Must be called with the lock held.
+func (s *Server) remove(r *resource, obj object) {
+	if r == namespaces {
+		for _, nr := range resources {
+			if !nr.namespaced {
+				continue
+			}
+			for _, nobj := range s.list(nr, metaString(obj, "name"), selectors{}) {
+				s.store(nr, nobj, "DELETED")
+			}
+		}
+	}
+	s.store(r, obj, "DELETED")
+}
+
+func decodeObject(r *http.Request) (object, error) {
+	obj := object{}
+	if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "unable to decode object")
+	}
+
+	return obj, nil
+}
+
+func deepCopy(obj object) object {
+	raw, _ := json.Marshal(obj)
+	res := object{}
+	json.Unmarshal(raw, &res) // nolint: errcheck
+
+	return res
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to target. Keys starting
+// with `$` are strategic merge patch directives and are ignored.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		switch {
+		case strings.HasPrefix(k, "$"):
+		case v == nil:
+			delete(t, k)
+		default:
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v) // nolint: errcheck
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	})
+}
+
+func writeNotFound(w http.ResponseWriter, req *request) {
+	writeStatus(w, http.StatusNotFound, "NotFound",
+		fmt.Sprintf("%s %q not found", req.resource, req.name))
+}
+
+func successStatus(r *resource, name string) object {
+	return object{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"status":     "Success",
+		"details": map[string]interface{}{
+			"name":  name,
+			"group": r.group,
+			"kind":  r.name,
+		},
+	}
+}
@@ -0,0 +1,210 @@
+package apiserver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// object is an unstructured Kubernetes object.
+type object = map[string]interface{}
+
+// event is a change to an object, as it is sent to watchers.
+type event struct {
+	Type   string `json:"type"`
+	Object object `json:"object"`
+}
+
+type watcher struct {
+	resource  *resource
+	namespace string
+	selectors selectors
+	events    chan event
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func metadata(obj object) map[string]interface{} {
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		meta = map[string]interface{}{}
+		obj["metadata"] = meta
+	}
+
+	return meta
+}
+
+func metaString(obj object, field string) string {
+	s, _ := metadata(obj)[field].(string)
+
+	return s
+}
+
+func labels(obj object) map[string]string {
+	res := map[string]string{}
+	l, _ := metadata(obj)["labels"].(map[string]interface{})
+	for k, v := range l {
+		res[k], _ = v.(string)
+	}
+
+	return res
+}
+
+// list returns the objects of the resource in the namespace, all namespaces
+// when empty, matching the selectors. Must be called with the lock held.
+func (s *Server) list(r *resource, namespace string, sel selectors) []object {
+	items := []object{}
+	for _, obj := range s.objects[r] {
+		if namespace != "" && metaString(obj, "namespace") != namespace {
+			continue
+		}
+		if sel.matches(obj) {
+			items = append(items, obj)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return key(metaString(items[i], "namespace"), metaString(items[i], "name")) <
+			key(metaString(items[j], "namespace"), metaString(items[j], "name"))
+	})
+
+	return items
+}
+
+// store persists the object and notifies the watchers. Must be called with the
+// lock held.
+func (s *Server) store(r *resource, obj object, eventType string) {
+	s.resourceVersion++
+	meta := metadata(obj)
+	meta["resourceVersion"] = strconv.Itoa(s.resourceVersion)
+	if eventType == "ADDED" {
+		meta["uid"] = uuid()
+		meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+		meta["generation"] = 1
+	}
+	obj["apiVersion"] = r.apiVersion()
+	obj["kind"] = r.kind
+
+	k := key(metaString(obj, "namespace"), metaString(obj, "name"))
+	if eventType == "DELETED" {
+		delete(s.objects[r], k)
+	} else {
+		s.objects[r][k] = obj
+	}
+	s.notify(r, event{Type: eventType, Object: obj})
+}
+
+func (s *Server) notify(r *resource, e event) {
+	for _, w := range s.watchers {
+		if w.resource != r ||
+			w.namespace != "" && w.namespace != metaString(e.Object, "namespace") ||
+			!w.selectors.matches(e.Object) {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			// Slow watchers miss events, clients re-list on reconnection.
+		}
+	}
+}
+
+func (s *Server) addWatcher(w *watcher) {
+	s.Lock()
+	defer s.Unlock()
+	s.watchers = append(s.watchers, w)
+}
+
+func (s *Server) removeWatcher(w *watcher) {
+	s.Lock()
+	defer s.Unlock()
+	for i, x := range s.watchers {
+		if x == w {
+			s.watchers = append(s.watchers[:i], s.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// selectors are the label and field selectors of a request. Only equality
+// based requirements and existence checks are supported.
+type selectors struct {
+	labels, fields []requirement
+}
+
+type requirement struct {
+	key, value string
+	op         string
+}
+
+func parseSelector(s string) []requirement {
+	reqs := []requirement{}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		switch {
+		case term == "":
+		case strings.Contains(term, "!="):
+			kv := strings.SplitN(term, "!=", 2)
+			reqs = append(reqs, requirement{kv[0], kv[1], "!="})
+		case strings.Contains(term, "=="):
+			kv := strings.SplitN(term, "==", 2)
+			reqs = append(reqs, requirement{kv[0], kv[1], "="})
+		case strings.Contains(term, "="):
+			kv := strings.SplitN(term, "=", 2)
+			reqs = append(reqs, requirement{kv[0], kv[1], "="})
+		case strings.HasPrefix(term, "!"):
+			reqs = append(reqs, requirement{term[1:], "", "!"})
+		default:
+			reqs = append(reqs, requirement{term, "", "exists"})
+		}
+	}
+
+	return reqs
+}
+
+func (sel selectors) matches(obj object) bool {
+	l := labels(obj)
+	for _, req := range sel.labels {
+		if !req.matches(l) {
+			return false
+		}
+	}
+	fields := map[string]string{
+		"metadata.name":      metaString(obj, "name"),
+		"metadata.namespace": metaString(obj, "namespace"),
+	}
+	for _, req := range sel.fields {
+		if !req.matches(fields) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (req requirement) matches(values map[string]string) bool {
+	value, ok := values[req.key]
+	switch req.op {
+	case "=":
+		return ok && value == req.value
+	case "!=":
+		return !ok || value != req.value
+	case "!":
+		return !ok
+	default:
+		return ok
+	}
+}
+
+func uuid() string {
+	b := make([]byte, 16)
+	rand.Read(b) // nolint: errcheck
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
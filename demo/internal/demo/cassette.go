@@ -0,0 +1,158 @@
+package demo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cassette contains the recorded execution of every step of a Run.
+type cassette struct {
+	Title    string    `json:"title"`
+	Recorded time.Time `json:"recorded"`
+	Tracks   []*track  `json:"tracks"`
+}
+
+// track is the recorded execution of a single step command. Occurrence
+// tells apart the executions of a step run several times, counting from 0.
+type track struct {
+	Step       int           `json:"step"`
+	Occurrence int           `json:"occurrence,omitempty"`
+	Command    string        `json:"command"`
+	ExitCode   int           `json:"exitCode"`
+	Duration   time.Duration `json:"duration"`
+	Output     []chunk       `json:"output"`
+}
+
+// chunk is a piece of the output of a command, written into Stream after
+// Offset since the command started.
+type chunk struct {
+	Offset time.Duration `json:"offset"`
+	Stream string        `json:"stream,omitempty"`
+	Data   string        `json:"data"`
+}
+
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// cassettePath returns the path of the cassette of the run with the provided
+// title within dir.
+func cassettePath(dir, title string) string {
+	name := strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(title), "-"), "-")
+
+	return filepath.Join(dir, name+".json")
+}
+
+func loadCassette(dir, title string) (*cassette, error) {
+	path := cassettePath(dir, title)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read cassette")
+	}
+	c := &cassette{}
+	if err := json.Unmarshal(content, c); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode cassette %s", path)
+	}
+
+	return c, nil
+}
+
+func (c *cassette) save(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err, "unable to create cassettes directory")
+	}
+	content := &bytes.Buffer{}
+	enc := json.NewEncoder(content)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return errors.Wrap(err, "unable to encode cassette")
+	}
+
+	return errors.Wrap(
+		ioutil.WriteFile(cassettePath(dir, c.Title), content.Bytes(), 0o644),
+		"unable to write cassette",
+	)
+}
+
+// track returns the recorded occurrence of the step, or its last recording
+// when the step ran fewer times while recording.
+func (c *cassette) track(step, occurrence int) *track {
+	var found *track
+	for _, t := range c.Tracks {
+		if t.Step == step && t.Occurrence <= occurrence &&
+			(found == nil || t.Occurrence > found.Occurrence) {
+			found = t
+		}
+	}
+
+	return found
+}
+
+// recorder stores everything written into its streams as timed chunks.
+type recorder struct {
+	sync.Mutex
+	start  time.Time
+	output []chunk
+}
+
+func newRecorder() *recorder {
+	return &recorder{start: time.Now()}
+}
+
+// stream returns an io.Writer recording into the stream with the provided
+// name.
+func (r *recorder) stream(name string) io.Writer {
+	return streamWriter(func(p []byte) (int, error) {
+		r.Lock()
+		defer r.Unlock()
+		r.output = append(r.output, chunk{
+			Offset: time.Since(r.start),
+			Stream: name,
+			Data:   string(p),
+		})
+
+		return len(p), nil
+	})
+}
+
+type streamWriter func(p []byte) (int, error)
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	return w(p)
+}
+
+// play writes the output of the track into the run output, with the same
+// pacing it was recorded with, and returns the recorded outcome.
+func (t *track) play(r *Run) (*Outcome, error) {
+	outcome := &Outcome{ExitCode: t.ExitCode}
+	start := time.Now()
+	for _, c := range t.Output {
+		time.Sleep(c.Offset - time.Since(start))
+		if err := write(r.out, c.Data); err != nil {
+			return nil, err
+		}
+		switch c.Stream {
+		case streamStdout:
+			outcome.Stdout += c.Data
+		case streamStderr:
+			outcome.Stderr += c.Data
+		}
+	}
+	time.Sleep(t.Duration - time.Since(start))
+
+	return outcome, nil
+}
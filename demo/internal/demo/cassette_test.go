@@ -0,0 +1,196 @@
+package demo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassettePath(t *testing.T) {
+	for title, expected := range map[string]string{
+		"Hello":                       "cassettes/hello.json",
+		"Kubewarden: Hello, World!":   "cassettes/kubewarden-hello-world.json",
+		"  Gatekeeper -- policies v2": "cassettes/gatekeeper-policies-v2.json",
+	} {
+		if got := cassettePath("cassettes", title); got != expected {
+			t.Errorf("%q: expected %q, got %q", title, expected, got)
+		}
+	}
+}
+
+// recordedRun is a run whose second step leaves a marker behind, to tell
+// whether its command got executed.
+func recordedRun(marker string) *Run {
+	r := NewRun("Recorded run")
+	r.Step(S("Greet"), S("echo hello"))
+	r.StepCanFail(S("Fail"), S("touch "+marker+"; echo failing; exit 3"))
+
+	return r
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "marker")
+
+	if _, err := runAuto(recordedRun(marker), Options{Record: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := loadCassette(dir, "Recorded run")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(c.Tracks))
+	}
+	for i, expected := range []struct {
+		command  string
+		exitCode int
+	}{
+		{"echo hello", 0},
+		{"touch " + marker + "; echo failing; exit 3", 3},
+	} {
+		tr := c.track(i+1, 0)
+		if tr == nil || tr.Command != expected.command || tr.ExitCode != expected.exitCode {
+			t.Errorf("unexpected track %d: %+v", i+1, tr)
+		}
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runAuto(recordedRun(marker), Options{Replay: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{"> echo hello\nhello\n", "failing\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in the replayed output, got:\n%s", expected, out)
+		}
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("expected the replayed command not to be executed")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRun("Recorded run")
+	r.Step(S("Greet"), S("echo hello"))
+	if _, err := runAuto(r, Options{Record: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		title  string
+		steps  [][]string
+		opts   Options
+		output string
+		err    string
+	}{
+		{
+			name:   "changed command",
+			title:  "Recorded run",
+			steps:  [][]string{S("echo hi")},
+			output: "# recorded command differs: echo hello\nhello\n",
+		},
+		{
+			name:  "step not recorded",
+			title: "Recorded run",
+			steps: [][]string{S("echo hello"), S("echo again")},
+			err:   "no recording available for step 2",
+		},
+		{
+			name:  "no cassette",
+			title: "Other run",
+			steps: [][]string{S("echo hello")},
+			err:   "unable to read cassette",
+		},
+		{
+			name:  "recording while replaying",
+			title: "Recorded run",
+			steps: [][]string{S("echo hello")},
+			opts:  Options{Record: dir},
+			err:   "recording and replaying at the same time is not possible",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRun(tc.title)
+			for _, command := range tc.steps {
+				r.Step(S("Greet"), command)
+			}
+			tc.opts.Replay = dir
+			out, err := runAuto(r, tc.opts)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(out, tc.output) {
+				t.Errorf("expected %q in the output, got:\n%s", tc.output, out)
+			}
+		})
+	}
+}
+
+func TestReplayOccurrences(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "counter")
+	run := func(opts Options, keys ...string) string {
+		t.Helper()
+		typeLines(t, keys...)
+		r := NewRun("Repeated run")
+		r.Step(S("Count"), S("echo x >> "+counter+"; printf 'count %s\\n' $(wc -l < "+counter+")"))
+		r.Step(S("Done"), nil)
+		out := &bytes.Buffer{}
+		if err := r.SetOutput(out); err != nil {
+			t.Fatal(err)
+		}
+		opts.Immediate = true
+		if err := r.RunWithOptions(opts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return out.String()
+	}
+
+	// The command runs, and is repeated from the prompt of the next step.
+	run(Options{Record: dir}, "", "", "r", "")
+	if err := os.Remove(counter); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		keys   []string
+		output []string
+	}{
+		{
+			name:   "as recorded",
+			keys:   []string{"", "", "r", ""},
+			output: []string{"count 1\n", "count 2\n"},
+		},
+		{
+			name:   "back to the step",
+			keys:   []string{"", "", "b", "", "", ""},
+			output: []string{"count 1\n", "# Count [1/2]:", "count 2\n"},
+		},
+		{
+			name:   "more often than recorded",
+			keys:   []string{"", "", "r", "r", ""},
+			output: []string{"count 1\n", "count 2\n", "count 2\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expectOutput(t, run(Options{Replay: dir}, tc.keys...), tc.output)
+			if _, err := os.Stat(counter); !os.IsNotExist(err) {
+				t.Error("expected the replayed command not to be executed")
+			}
+		})
+	}
+}
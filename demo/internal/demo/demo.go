@@ -0,0 +1,390 @@
+package demo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+type Demo struct {
+	*cli.App
+	runs    []*runFlag
+	setup   func(*cli.Context) error
+	cleanup func(*cli.Context) error
+	before  func(*cli.Context, *Run) error
+
+	// available tells why a run cannot start, shown by the picker.
+	available func(*cli.Context, *Run) error
+
+	mu          sync.Mutex
+	active      *Run
+	interrupted bool
+
+	// cleaning serializes the cleanups of the runs and of an interrupt,
+	// dirty tells whether the setup ran since the last cleanup.
+	cleaning sync.Mutex
+	dirty    bool
+}
+
+type runFlag struct {
+	run  *Run
+	flag cli.Flag
+}
+
+const (
+	// FlagAll is the flag for running all demos.
+	FlagAll = "all"
+
+	// FlagAuto is the flag for running in automatic mode.
+	FlagAuto = "auto"
+
+	// FlagAutoTimeout is the flag for the timeout to be waited when `auto` is
+	// enabled.
+	FlagAutoTimeout = "auto-timeout"
+
+	// FlagContinuously is the flag for running the demos continuously without
+	// any end.
+	FlagContinuously = "continuously"
+
+	// FlagHideDescriptions is the flag for hiding the descriptions.
+	FlagHideDescriptions = "hide-descriptions"
+
+	// FlagImmediate is the flag for disabling the text animations.
+	FlagImmediate = "immediate"
+
+	// FlagSkipSteps is the flag for skipping n amount of steps.
+	FlagSkipSteps = "skip-steps"
+
+	// FlagRecord is the flag for recording the steps into cassettes.
+	FlagRecord = "record"
+
+	// FlagReplay is the flag for replaying the steps from cassettes.
+	FlagReplay = "replay"
+
+	// FlagStepTimeout is the flag for the time every step command may
+	// take, overriding the timeouts of the runs.
+	FlagStepTimeout = "step-timeout"
+
+	// FlagFallback is the flag for the directory of the recordings played
+	// back when a step command times out.
+	FlagFallback = "fallback"
+
+	// FlagCleanupTimeout is the flag for the time the cleanup may take when
+	// a run gets interrupted.
+	FlagCleanupTimeout = "cleanup-timeout"
+)
+
+// New creates a new Demo instance.
+func New() *Demo {
+	app := cli.NewApp()
+	app.UseShortOptionHandling = true
+
+	app.Flags = []cli.Flag{
+		&cli.BoolFlag{
+			Name:    FlagAll,
+			Aliases: []string{"l"},
+			Usage:   "run all demos",
+		},
+		&cli.BoolFlag{
+			Name:    FlagAuto,
+			Aliases: []string{"a"},
+			Usage: "run the demo in automatic mode, " +
+				"where every step gets executed automatically",
+		},
+		&cli.DurationFlag{
+			Name:    FlagAutoTimeout,
+			Aliases: []string{"t"},
+			Usage:   "the timeout to be waited when `auto` is enabled",
+			Value:   3 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:    FlagContinuously,
+			Aliases: []string{"c"},
+			Usage:   "run the demos continuously without any end",
+		},
+		&cli.BoolFlag{
+			Name:    FlagHideDescriptions,
+			Aliases: []string{"d"},
+			Usage:   "hide descriptions between the steps",
+		},
+		&cli.BoolFlag{
+			Name:    FlagImmediate,
+			Aliases: []string{"i"},
+			Usage:   "immediately output without the typewriter animation",
+		},
+		&cli.IntFlag{
+			Name:    FlagSkipSteps,
+			Aliases: []string{"s"},
+			Usage:   "skip the amount of initial steps within the demo",
+		},
+		&cli.StringFlag{
+			Name: FlagRecord,
+			Usage: "record the output of every step into a cassette per run, " +
+				"within the provided directory",
+		},
+		&cli.StringFlag{
+			Name: FlagReplay,
+			Usage: "play back the steps from the cassettes within the provided " +
+				"directory, without executing anything",
+		},
+		&cli.DurationFlag{
+			Name: FlagStepTimeout,
+			Usage: "the time every step command may take before getting killed, " +
+				"overriding the timeouts of the runs",
+		},
+		&cli.StringFlag{
+			Name: FlagFallback,
+			Usage: "play back the recorded output of the steps timing out from " +
+				"the cassettes within the provided directory, when they allow it",
+		},
+		&cli.DurationFlag{
+			Name:  FlagCleanupTimeout,
+			Usage: "the time the cleanup of a run may take when it gets interrupted",
+			Value: 30 * time.Second,
+		},
+	}
+
+	emptyFn := func(*cli.Context) error { return nil }
+	demo := &Demo{
+		App:     app,
+		runs:    nil,
+		setup:   emptyFn,
+		cleanup: emptyFn,
+		before:  func(*cli.Context, *Run) error { return nil },
+
+		available: func(*cli.Context, *Run) error { return nil },
+	}
+
+	app.Action = func(ctx *cli.Context) error {
+		runs := []choice{}
+
+		for _, x := range demo.runs {
+			isSet := false
+			for _, name := range x.flag.Names() {
+				if ctx.Bool(name) {
+					isSet = true
+				}
+			}
+			if ctx.Bool(FlagAll) || isSet {
+				runs = append(runs, choice{x.run, ctx.Int(FlagSkipSteps)})
+			}
+		}
+		if len(runs) == 0 && len(demo.runs) > 0 {
+			if !isTerminal() {
+				return errors.Errorf(
+					"no run selected, use --%s or one of %s", FlagAll, demo.runNames(),
+				)
+			}
+			var err error
+			if runs, err = demo.pick(ctx); err != nil {
+				return errors.Wrap(err, "unable to pick the runs")
+			}
+		}
+
+		runSelected := func() error {
+			for _, c := range runs {
+				run := c.run
+				demo.setDirty()
+				if err := demo.setup(ctx); err != nil {
+					return err
+				}
+				if err := demo.before(ctx, run); err != nil {
+					demo.cleanupAfterError(ctx)
+					return err
+				}
+				demo.setActive(run)
+				opts := optionsFrom(ctx)
+				opts.SkipSteps = c.skip
+				err := run.RunWithOptions(opts)
+				demo.setActive(nil)
+				if err != nil {
+					demo.cleanupAfterError(ctx)
+					return err
+				}
+				if err := demo.cleanupOnce(ctx); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+		if ctx.Bool(FlagContinuously) {
+			for {
+				if err := runSelected(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return runSelected()
+	}
+
+	return demo
+}
+
+// Setup sets the cleanup function called before each run.
+func (d *Demo) Setup(setupFn func(*cli.Context) error) {
+	d.setup = setupFn
+}
+
+// Cleanup sets the cleanup function called after each run.
+func (d *Demo) Cleanup(cleanupFn func(*cli.Context) error) {
+	d.cleanup = cleanupFn
+}
+
+// BeforeRun sets a function called before each run starts, after the setup
+// function of the demo. Returning an error prevents the run from starting.
+func (d *Demo) BeforeRun(beforeFn func(*cli.Context, *Run) error) {
+	d.before = beforeFn
+}
+
+// Availability sets a function telling why a run cannot start, like a
+// missing tool. The picker shown when no run is selected with the flags
+// lists the reason next to the run, which cannot be picked then.
+func (d *Demo) Availability(availableFn func(*cli.Context, *Run) error) {
+	d.available = availableFn
+}
+
+func (d *Demo) Add(run *Run, name, description string) {
+	flag := &cli.BoolFlag{
+		Name:    fmt.Sprintf("%d", len(d.runs)),
+		Aliases: []string{name},
+		Usage:   description,
+	}
+	d.Flags = append(d.Flags, flag)
+	d.runs = append(d.runs, &runFlag{run, flag})
+}
+
+// Entry is a run added to the demo, along with the flag selecting it.
+type Entry struct {
+	// Index is the name of the flag, Name is its alias.
+	Index int
+	Name  string
+	Usage string
+	Run   *Run
+}
+
+// Entries returns the runs added to the demo, with the flags selecting them.
+func (d *Demo) Entries() []Entry {
+	entries := []Entry{}
+	for i, x := range d.runs {
+		entries = append(entries, Entry{Index: i, Name: x.name(), Usage: x.usage(), Run: x.run})
+	}
+
+	return entries
+}
+
+// Runs returns the runs added to the demo.
+func (d *Demo) Runs() []*Run {
+	runs := []*Run{}
+	for _, x := range d.runs {
+		runs = append(runs, x.run)
+	}
+
+	return runs
+}
+
+// runNames returns the flags selecting the runs.
+func (d *Demo) runNames() string {
+	names := []string{}
+	for _, x := range d.runs {
+		names = append(names, "--"+x.name())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Run starts the demo.
+func (d *Demo) Run() {
+	// Catch interrupts and cleanup
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		for range c {
+			d.interrupt()
+		}
+	}()
+
+	if err := d.App.Run(os.Args); err != nil {
+		// An interrupt makes the running step fail, let the interrupt
+		// handler finish the cleanup and exit.
+		if d.isInterrupted() {
+			select {}
+		}
+		log.Printf("run failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+// interrupt stops the active run and cleans up everything before exiting.
+func (d *Demo) interrupt() {
+	d.mu.Lock()
+	if d.interrupted {
+		d.mu.Unlock()
+		return
+	}
+	d.interrupted = true
+	active := d.active
+	d.mu.Unlock()
+
+	if active != nil {
+		active.interrupt()
+	}
+	if err := d.cleanupOnce(nil); err != nil {
+		log.Printf("unable to cleanup: %v", err)
+	}
+	// Exiting skips the deferred restores of the terminal, and the status
+	// tells the shell the demo got interrupted, like 128 + SIGINT.
+	restoreTerminal()
+	os.Exit(130)
+}
+
+// cleanupAfterError cleans up after a run that failed, unless it failed
+// because of an interrupt, which cleans up on its own.
+func (d *Demo) cleanupAfterError(ctx *cli.Context) {
+	if d.isInterrupted() {
+		return
+	}
+	if err := d.cleanupOnce(ctx); err != nil {
+		log.Printf("unable to cleanup: %v", err)
+	}
+}
+
+// cleanupOnce runs the cleanup of the demo, unless it already ran since the
+// last setup. A cleanup in progress is waited for.
+func (d *Demo) cleanupOnce(ctx *cli.Context) error {
+	d.cleaning.Lock()
+	defer d.cleaning.Unlock()
+	if !d.dirty {
+		return nil
+	}
+	d.dirty = false
+
+	return d.cleanup(ctx)
+}
+
+func (d *Demo) setDirty() {
+	d.cleaning.Lock()
+	defer d.cleaning.Unlock()
+	d.dirty = true
+}
+
+func (d *Demo) setActive(r *Run) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active = r
+}
+
+func (d *Demo) isInterrupted() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.interrupted
+}
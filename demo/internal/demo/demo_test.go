@@ -0,0 +1,53 @@
+package demo
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestCleanupOnce(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		interrupted bool
+		setup       bool
+		cleanups    int
+	}{
+		{name: "after a setup", setup: true, cleanups: 1},
+		{name: "without a setup", cleanups: 0},
+		{name: "after an interrupt", setup: true, interrupted: true, cleanups: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cleanups := 0
+			d := New()
+			d.Cleanup(func(*cli.Context) error {
+				cleanups++
+				return nil
+			})
+			if tc.setup {
+				d.setDirty()
+			}
+			d.interrupted = tc.interrupted
+
+			// The failing run and the interrupt handler race to clean up,
+			// as when an interrupt kills the step command.
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				d.cleanupAfterError(nil)
+			}()
+			go func() {
+				defer wg.Done()
+				if err := d.cleanupOnce(nil); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}()
+			wg.Wait()
+			if cleanups != tc.cleanups {
+				t.Errorf("expected %d cleanups, got %d", tc.cleanups, cleanups)
+			}
+		})
+	}
+}
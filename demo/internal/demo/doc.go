@@ -0,0 +1,6 @@
+// Package demo is a framework for performing live command line demos.
+//
+// It started as a copy of github.com/saschagrunert/demo, and keeps its API, so
+// that the steps of the runs can be executed in ways the upstream framework
+// has no hooks for.
+package demo
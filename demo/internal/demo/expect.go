@@ -0,0 +1,157 @@
+package demo
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+)
+
+// Outcome is the result of the execution of a step command. Commands run in
+// a pseudo-terminal have both of their output streams in Stdout.
+type Outcome struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// Expectation verifies the Outcome of a step command.
+type Expectation interface {
+	// Check returns an error describing why the outcome is not the
+	// expected one, or nil if it is.
+	Check(*Outcome) error
+}
+
+// ExpectationFunc is an adapter to use ordinary functions as Expectations.
+type ExpectationFunc func(*Outcome) error
+
+// Check calls f(o).
+func (f ExpectationFunc) Check(o *Outcome) error {
+	return f(o)
+}
+
+type exitCode int
+
+func (e exitCode) Check(o *Outcome) error {
+	if o.ExitCode != int(e) {
+		return errors.Errorf("exit code is %d, expected %d", o.ExitCode, e)
+	}
+
+	return nil
+}
+
+// ExitCode expects the command to exit with the provided code.
+func ExitCode(code int) Expectation {
+	return exitCode(code)
+}
+
+// StdoutContains expects the standard output to contain s.
+func StdoutContains(s string) Expectation {
+	return contains("stdout", s, func(o *Outcome) string { return o.Stdout })
+}
+
+// StderrContains expects the standard error to contain s.
+func StderrContains(s string) Expectation {
+	return contains("stderr", s, func(o *Outcome) string { return o.Stderr })
+}
+
+// OutputContains expects the standard output or error to contain s.
+func OutputContains(s string) Expectation {
+	return contains("output", s, func(o *Outcome) string { return o.Stdout + o.Stderr })
+}
+
+// StdoutMatches expects the standard output to match the regular expression.
+func StdoutMatches(expr string) Expectation {
+	return matches("stdout", expr, func(o *Outcome) string { return o.Stdout })
+}
+
+// StderrMatches expects the standard error to match the regular expression.
+func StderrMatches(expr string) Expectation {
+	return matches("stderr", expr, func(o *Outcome) string { return o.Stderr })
+}
+
+// OutputMatches expects the standard output or error to match the regular
+// expression.
+func OutputMatches(expr string) Expectation {
+	return matches("output", expr, func(o *Outcome) string { return o.Stdout + o.Stderr })
+}
+
+func contains(name, s string, get func(*Outcome) string) Expectation {
+	return ExpectationFunc(func(o *Outcome) error {
+		if !strings.Contains(get(o), s) {
+			return errors.Errorf("%s does not contain %q", name, s)
+		}
+		return nil
+	})
+}
+
+func matches(name, expr string, get func(*Outcome) string) Expectation {
+	re := regexp.MustCompile(expr)
+
+	return ExpectationFunc(func(o *Outcome) error {
+		if !re.MatchString(get(o)) {
+			return errors.Errorf("%s does not match %q", name, expr)
+		}
+		return nil
+	})
+}
+
+// Allowed expects the standard output to be a kwctl ValidationResponse with
+// the provided verdict.
+func Allowed(allowed bool) Expectation {
+	return ExpectationFunc(func(o *Outcome) error {
+		var response struct {
+			Allowed *bool `json:"allowed"`
+		}
+		if err := json.NewDecoder(strings.NewReader(o.Stdout)).Decode(&response); err != nil {
+			return errors.Wrap(err, "stdout is not a ValidationResponse")
+		}
+		if response.Allowed == nil {
+			return errors.New("stdout is not a ValidationResponse: allowed is missing")
+		}
+		if *response.Allowed != allowed {
+			return errors.Errorf("request allowed is %t, expected %t", *response.Allowed, allowed)
+		}
+		return nil
+	})
+}
+
+// check verifies the outcome against the expectations of the step. Failures
+// are reported, and abort the run when it is automatic.
+func (s *step) check(o *Outcome) (bool, error) {
+	expectations := s.expectations
+	hasExitCode := false
+	for _, e := range expectations {
+		if _, ok := e.(exitCode); ok {
+			hasExitCode = true
+		}
+	}
+	if !hasExitCode {
+		expectations = append([]Expectation{ExitCode(0)}, expectations...)
+	}
+
+	failures := []string{}
+	for _, e := range expectations {
+		if err := e.Check(o); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) == 0 {
+		s.print("")
+		return true, nil
+	}
+
+	for _, f := range failures {
+		s.print(color.Red.Sprintf("✗ expectation failed: %s", f))
+	}
+	s.print("")
+	if s.r.options.Auto {
+		return false, errors.Errorf(
+			"step expectations not met: %s", strings.Join(failures, ", "),
+		)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,125 @@
+package demo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpectations(t *testing.T) {
+	outcome := &Outcome{
+		ExitCode: 1,
+		Stdout:   `{"uid": "1", "allowed": false, "status": {"message": "rejected"}}`,
+		Stderr:   "warning: deprecated\n",
+	}
+	for _, tc := range []struct {
+		name        string
+		expectation Expectation
+		err         string
+	}{
+		{"exit code", ExitCode(1), ""},
+		{"other exit code", ExitCode(0), "exit code is 1, expected 0"},
+		{"stdout contains", StdoutContains(`"allowed": false`), ""},
+		{"stdout does not contain", StdoutContains("deprecated"), `stdout does not contain "deprecated"`},
+		{"stderr contains", StderrContains("deprecated"), ""},
+		{"stderr does not contain", StderrContains("rejected"), `stderr does not contain "rejected"`},
+		{"output contains", OutputContains("deprecated"), ""},
+		{"output does not contain", OutputContains("accepted"), `output does not contain "accepted"`},
+		{"stdout matches", StdoutMatches(`"message": "rej\w+"`), ""},
+		{"stdout does not match", StdoutMatches(`^warning`), "stdout does not match \"^warning\""},
+		{"stderr matches", StderrMatches(`^warning`), ""},
+		{"stderr does not match", StderrMatches(`allowed`), `stderr does not match "allowed"`},
+		{"output matches", OutputMatches(`(?s)allowed.*deprecated`), ""},
+		{"output does not match", OutputMatches(`^deprecated`), `output does not match "^deprecated"`},
+		{"rejected", Allowed(false), ""},
+		{"not allowed", Allowed(true), "request allowed is false, expected true"},
+		{
+			name: "function",
+			expectation: ExpectationFunc(func(o *Outcome) error {
+				return ExitCode(2).Check(o)
+			}),
+			err: "exit code is 1, expected 2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.expectation.Check(outcome)
+			if tc.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("expected the error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	for stdout, expected := range map[string]string{
+		`{"allowed": true}`:      "",
+		`{"allowed": true} more`: "",
+		`{"uid": "1"}`:           "stdout is not a ValidationResponse: allowed is missing",
+		`Error: no policy`:       "stdout is not a ValidationResponse",
+		``:                       "stdout is not a ValidationResponse",
+	} {
+		err := Allowed(true).Check(&Outcome{Stdout: stdout})
+		if expected == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", stdout, err)
+		}
+		if expected != "" && (err == nil || !strings.HasPrefix(err.Error(), expected)) {
+			t.Errorf("%q: expected an error starting with %q, got %v", stdout, expected, err)
+		}
+	}
+}
+
+func TestStepExpect(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		command      string
+		expectations []Expectation
+		output       string
+		err          string
+	}{
+		{
+			name:         "met",
+			command:      "echo hello",
+			expectations: []Expectation{StdoutContains("hello")},
+		},
+		{
+			name:         "zero exit code expected",
+			command:      "echo hello; exit 2",
+			expectations: []Expectation{StdoutContains("hello")},
+			output:       "✗ expectation failed: exit code is 2, expected 0",
+			err:          "step expectations not met: exit code is 2, expected 0",
+		},
+		{
+			name:         "other exit code expected",
+			command:      "echo hello; exit 2",
+			expectations: []Expectation{ExitCode(2)},
+		},
+		{
+			name:         "every failure",
+			command:      "echo hello",
+			expectations: []Expectation{StdoutContains("bye"), StderrContains("hello")},
+			output:       "✗ expectation failed: stdout does not contain \"bye\"\n✗ expectation failed: stderr does not contain \"hello\"",
+			err:          `step expectations not met: stdout does not contain "bye", stderr does not contain "hello"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRun("Title")
+			r.StepExpect(S("Step"), S(tc.command), tc.expectations...)
+			r.Step(S("Next step"), S("echo next"))
+			out, err := runAuto(r, Options{})
+			if !strings.Contains(out, tc.output) {
+				t.Errorf("expected %q in the output, got:\n%s", tc.output, out)
+			}
+			if tc.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+			if ran := strings.Contains(out, "Next step"); ran != (tc.err == "") {
+				t.Errorf("expected the next step to run: %t, got %t", tc.err == "", ran)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package demo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// input reads the standard input of the demo in the background, so that it
+// can be handed over to the commands running in a pseudo-terminal, and back
+// to the prompts between the steps, without losing keystrokes.
+type input struct {
+	once    sync.Once
+	chunks  chan []byte
+	err     error
+	pending []byte
+}
+
+var stdin = &input{}
+
+func (in *input) start() {
+	in.once.Do(func() {
+		in.chunks = make(chan []byte)
+		go in.read()
+	})
+}
+
+func (in *input) read() {
+	for {
+		buf := make([]byte, 1024)
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			in.chunks <- buf[:n]
+		}
+		if err != nil {
+			in.err = err
+			close(in.chunks)
+			return
+		}
+	}
+}
+
+// readLine returns the next line of the input, including the newline.
+func (in *input) readLine() ([]byte, error) {
+	in.start()
+	for {
+		if i := bytes.IndexByte(in.pending, '\n'); i >= 0 {
+			line := in.pending[:i+1]
+			in.pending = in.pending[i+1:]
+			return line, nil
+		}
+		chunk, ok := <-in.chunks
+		if !ok {
+			return nil, in.err
+		}
+		in.pending = append(in.pending, chunk...)
+	}
+}
+
+// forward copies the input into w until done is closed. The input cannot be
+// read from anywhere else meanwhile. A Ctrl-C, which a terminal in raw mode
+// turns into a key, interrupts the demo instead of being copied, so that
+// the run gets cleaned up.
+func (in *input) forward(w io.Writer, done <-chan struct{}) {
+	in.start()
+	chunk := in.pending
+	in.pending = nil
+	for {
+		if i := bytes.IndexByte(chunk, ctrlC); i >= 0 {
+			w.Write(chunk[:i]) // nolint: errcheck
+			interruptSelf()
+			return
+		}
+		w.Write(chunk) // nolint: errcheck
+
+		var ok bool
+		select {
+		case <-done:
+			return
+		case chunk, ok = <-in.chunks:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// ctrlC is the key sent by Ctrl-C in raw mode.
+const ctrlC byte = 0x03
+
+// interruptSelf sends an interrupt to the demo, as Ctrl-C does when the
+// terminal is not in raw mode.
+func interruptSelf() {
+	if p, err := os.FindProcess(os.Getpid()); err == nil {
+		p.Signal(os.Interrupt) // nolint: errcheck
+	}
+}
+
+// readChunk returns what the presenter typed next, waiting at most timeout
+// when it is positive. It returns false when nothing was typed in time.
+func (in *input) readChunk(timeout time.Duration) ([]byte, bool, error) {
+	in.start()
+	if len(in.pending) > 0 {
+		chunk := in.pending
+		in.pending = nil
+		return chunk, true, nil
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case chunk, ok := <-in.chunks:
+		if !ok {
+			return nil, false, in.err
+		}
+		return chunk, true, nil
+	case <-expired:
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,88 @@
+package demo
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+)
+
+// start starts the command of a step, keeping track of it so that it can be
+// killed on interrupt.
+func (r *Run) start(cmd *exec.Cmd) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.current = cmd
+
+	return nil
+}
+
+// wait waits for the command started by start to finish.
+func (r *Run) wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	r.mu.Lock()
+	r.current = nil
+	r.mu.Unlock()
+
+	return err
+}
+
+func (r *Run) setSetupDone(done bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setupDone = done
+}
+
+// interrupt kills the running step command along with all its child
+// processes, and runs the cleanup of the run, giving up after the cleanup
+// timeout.
+func (r *Run) interrupt() {
+	r.mu.Lock()
+	cmd, setupDone := r.current, r.setupDone
+	r.mu.Unlock()
+
+	r.report(color.Yellow, "Interrupted %q", r.title)
+	if cmd != nil {
+		if err := killProcessGroup(cmd); err != nil {
+			r.report(color.Red, "Unable to kill %q: %v", cmdLine(cmd), err)
+		} else {
+			r.report(color.Yellow, "Killed %q and its child processes", cmdLine(cmd))
+		}
+	}
+	if !setupDone {
+		return
+	}
+
+	timeout := 30 * time.Second
+	if r.options != nil && r.options.CleanupTimeout > 0 {
+		timeout = r.options.CleanupTimeout
+	}
+	r.report(color.Yellow, "Running the cleanup of %q", r.title)
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- r.cleanup() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			r.report(color.Red, "Cleanup failed: %v", errors.Cause(err))
+			return
+		}
+		r.report(color.Green, "Cleanup finished in %s", time.Since(start).Round(time.Millisecond))
+	case <-time.After(timeout):
+		r.report(color.Red, "Cleanup did not finish within %s, giving up", timeout)
+	}
+}
+
+func (r *Run) report(c color.Color, format string, args ...interface{}) {
+	write(r.out, "\n"+c.Sprintf(format, args...)+"\n") // nolint: errcheck
+}
+
+func cmdLine(cmd *exec.Cmd) string {
+	return strings.Join(cmd.Args[2:], " ")
+}
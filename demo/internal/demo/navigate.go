@@ -0,0 +1,228 @@
+package demo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+)
+
+// move is what the presenter asks for while the run waits for them.
+type move int
+
+const (
+	// moveNext goes on with the run.
+	moveNext move = iota
+
+	// moveBack presents the previous step again.
+	moveBack
+
+	// moveRepeat runs the last command again.
+	moveRepeat
+
+	// moveJump presents the step of the navigation.
+	moveJump
+
+	// moveSkip goes on without running the command of the step.
+	moveSkip
+
+	// moveReset cleans up and runs the setup again before running the
+	// command of the step.
+	moveReset
+)
+
+type navigation struct {
+	move move
+	step int
+}
+
+var next = navigation{move: moveNext}
+
+const navigationHelp = "enter: next, b: back, r: repeat the last command, " +
+	"g or 1-9: jump to a step, p: pause or resume auto mode, i: toggle immediate mode"
+
+// SetSideEffects sets the function telling whether a step command changes
+// things outside of the demo, like a cluster. Running such commands again
+// when navigating the run asks for confirmation first.
+func (r *Run) SetSideEffects(fn func(command string) bool) {
+	r.sideEffects = fn
+}
+
+// id identifies the command of a step, to know whether it already ran.
+func (s *step) id() string {
+	return s.key() + "\x00" + strings.Join(s.command, " ")
+}
+
+func (s *step) hasSideEffects() bool {
+	return s.r.sideEffects != nil && s.r.sideEffects(strings.Join(s.command, " "))
+}
+
+// prompt waits for the presenter to go on, or for the auto timeout. Keys
+// toggling modes are handled right away. When confirming, the presenter
+// has to answer even in auto mode, and may skip the command or reset the
+// run.
+//
+// Keys are read as they are pressed when the demo runs in a terminal, and
+// as lines otherwise, where steps are jumped to with `g N`.
+func (r *Run) prompt(confirm bool) (navigation, error) {
+	for {
+		auto := r.options.Auto && !confirm
+		if auto && !isTerminal() {
+			time.Sleep(r.options.AutoTimeout)
+			return next, nil
+		}
+
+		var timeout time.Duration
+		if auto {
+			// Zero would wait forever for a key.
+			timeout = max(r.options.AutoTimeout, time.Millisecond)
+		} else if err := write(r.out, "…"); err != nil {
+			return next, err
+		}
+		key, ok, err := r.readKey(timeout)
+		if !auto {
+			r.clearPrompt()
+		}
+		if err != nil {
+			return next, errors.Wrap(err, "unable to read the keyboard")
+		}
+		if !ok {
+			return next, nil
+		}
+		if nav, done := r.handleKey(key, confirm); done {
+			return nav, nil
+		}
+	}
+}
+
+func (r *Run) readKey(timeout time.Duration) (string, bool, error) {
+	if !isTerminal() {
+		line, err := stdin.readLine()
+		return strings.TrimSpace(string(line)), err == nil, err
+	}
+
+	restore := rawMode()
+	defer restore()
+	key, ok, err := stdin.readChunk(timeout)
+
+	return string(key), ok, err
+}
+
+func (r *Run) clearPrompt() {
+	if isTerminal() {
+		write(r.out, "\r\x1b[2K") // nolint: errcheck
+		return
+	}
+	// Move the cursor up again, over the newline of the presenter.
+	write(r.out, "\x1b[1A") // nolint: errcheck
+}
+
+// handleKey returns where to go for the key, or false when the run has to
+// keep on waiting.
+func (r *Run) handleKey(key string, confirm bool) (navigation, bool) {
+	switch {
+	case key == "" || key == "\r" || key == "\n" || key == " " || key == "\x1b[C":
+		return next, true
+	case key == "b" || key == "\x1b[D":
+		return navigation{move: moveBack}, true
+	case key == "r":
+		return navigation{move: moveRepeat}, true
+	case key == "g" || strings.HasPrefix(key, "g ") || (key[0] >= '1' && key[0] <= '9'):
+		if step, ok := r.readStep(strings.TrimSpace(strings.TrimPrefix(key, "g"))); ok {
+			return navigation{move: moveJump, step: step}, true
+		}
+	case key == "p":
+		r.options.Auto = !r.options.Auto
+		if r.options.Auto {
+			r.notice("auto mode resumed")
+		} else {
+			r.notice("auto mode paused")
+		}
+	case key == "i":
+		r.options.Immediate = !r.options.Immediate
+		r.notice(fmt.Sprintf("immediate mode %s", map[bool]string{true: "on", false: "off"}[r.options.Immediate]))
+	case confirm && key == "s":
+		return navigation{move: moveSkip}, true
+	case confirm && key == "c":
+		return navigation{move: moveReset}, true
+	case key == string(ctrlC):
+		interruptSelf()
+	default:
+		r.notice(navigationHelp)
+	}
+
+	return next, false
+}
+
+// readStep reads the number of the step to jump to, starting with typed,
+// and returns its index.
+func (r *Run) readStep(typed string) (int, bool) {
+	if isTerminal() {
+		write(r.out, "jump to step: "+typed) // nolint: errcheck
+		for {
+			key, _, err := r.readKey(0)
+			if err != nil || key == "\x1b" || key == "\x03" {
+				r.clearPrompt()
+				return 0, false
+			}
+			if key == "\r" || key == "\n" {
+				break
+			}
+			if key == "\x7f" && typed != "" {
+				typed = typed[:len(typed)-1]
+				write(r.out, "\b \b") // nolint: errcheck
+				continue
+			}
+			if len(key) == 1 && key[0] >= '0' && key[0] <= '9' {
+				typed += key
+				write(r.out, key) // nolint: errcheck
+			}
+		}
+		r.clearPrompt()
+	}
+
+	n, err := strconv.Atoi(typed)
+	if err != nil || n < 1 || n > len(r.steps) {
+		r.notice(fmt.Sprintf("there is no step %q, the run has %d steps", typed, len(r.steps)))
+		return 0, false
+	}
+
+	return n - 1, true
+}
+
+func (r *Run) notice(message string) {
+	line := color.Yellow.Sprint(message) + "\n"
+	if isTerminal() {
+		line = "\r\x1b[2K" + color.Yellow.Sprint(message) + "\r\n"
+	}
+	write(r.out, line) // nolint: errcheck
+}
+
+// repeat runs the command of the step at index last again.
+func (r *Run) repeat(last int) error {
+	if last < 0 || last >= len(r.steps) {
+		r.notice("no command ran yet")
+		return nil
+	}
+	_, _, err := r.steps[last].execute(last+1, false)
+
+	return err
+}
+
+// resetup cleans up and runs the setup of the run again, so that the steps
+// changing the cluster can run again from a clean state.
+func (r *Run) resetup() error {
+	r.report(color.Yellow, "Cleaning up and setting up %q again", r.title)
+	if err := r.cleanup(); err != nil {
+		return errors.Wrap(err, "cleanup failed")
+	}
+	if err := r.setup(); err != nil {
+		return errors.Wrap(err, "setup failed")
+	}
+	r.ran = map[string]bool{}
+
+	return nil
+}
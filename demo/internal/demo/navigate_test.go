@@ -0,0 +1,184 @@
+package demo
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// typeLines makes the presenter type the provided lines, one per prompt,
+// and then close the input.
+func typeLines(t *testing.T, lines ...string) {
+	t.Helper()
+	chunks := make(chan []byte, len(lines))
+	for _, l := range lines {
+		chunks <- []byte(l + "\n")
+	}
+	close(chunks)
+
+	previous := stdin
+	stdin = &input{chunks: chunks, err: io.EOF}
+	stdin.once.Do(func() {})
+	t.Cleanup(func() { stdin = previous })
+}
+
+func TestNavigation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+
+		// keys are typed at each prompt: every step with a command
+		// prompts once before presenting it, and once before running it.
+		keys   []string
+		output []string
+
+		// missing must not be in the output.
+		missing []string
+	}{
+		{
+			name:   "next",
+			keys:   []string{"", "", "", "", "", ""},
+			output: []string{"# One [1/3]:", "one ran\n", "# Two [2/3]:", "two ran\n", "# Three [3/3]:", "three ran\n"},
+		},
+		{
+			name:   "back",
+			keys:   []string{"", "", "b", "", "", "", "", "", ""},
+			output: []string{"one ran\n", "# One [1/3]:", "one ran\n", "two ran\n", "three ran\n"},
+		},
+		{
+			name:   "back from the command",
+			keys:   []string{"", "", "", "b", "", "", "", "", "", ""},
+			output: []string{"one ran\n", "> printf '%s ran\\n' two", "# One [1/3]:", "one ran\n", "two ran\n", "three ran\n"},
+		},
+		{
+			name:   "repeat",
+			keys:   []string{"", "", "r", "", "", "", ""},
+			output: []string{"one ran\n", "> printf", "one ran\n", "two ran\n", "three ran\n"},
+		},
+		{
+			name:   "repeat before any command",
+			keys:   []string{"r", "", "", "", "", "", ""},
+			output: []string{"no command ran yet", "one ran\n", "two ran\n", "three ran\n"},
+		},
+		{
+			name:    "jump",
+			keys:    []string{"g 3", "", ""},
+			output:  []string{"# Three [3/3]:", "three ran\n"},
+			missing: []string{"one ran\n", "two ran\n"},
+		},
+		{
+			name:   "jump with the step number",
+			keys:   []string{"", "", "", "", "1", "", "", "", "", "", ""},
+			output: []string{"one ran\n", "two ran\n", "# One [1/3]:", "one ran\n", "two ran\n", "three ran\n"},
+		},
+		{
+			name:   "jump to a missing step",
+			keys:   []string{"g 9", "g", "", "", "", "", "", ""},
+			output: []string{`there is no step "9", the run has 3 steps`, `there is no step "", the run has 3 steps`, "one ran\n"},
+		},
+		{
+			name:   "unknown key",
+			keys:   []string{"x", "", "", "", "", "", ""},
+			output: []string{navigationHelp, "one ran\n", "two ran\n", "three ran\n"},
+		},
+		{
+			name:   "auto mode",
+			keys:   []string{"", "", "p"},
+			output: []string{"one ran\n", "auto mode resumed", "two ran\n", "three ran\n"},
+		},
+		{
+			name:   "immediate mode",
+			keys:   []string{"i", "i", "", "", "", "", "", ""},
+			output: []string{"immediate mode off", "immediate mode on", "one ran\n", "three ran\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			typeLines(t, tc.keys...)
+			r := NewRun("Title")
+			r.Step(S("One"), S(`printf '%s ran\n' one`))
+			r.Step(S("Two"), S(`printf '%s ran\n' two`))
+			r.Step(S("Three"), S(`printf '%s ran\n' three`))
+
+			out := &bytes.Buffer{}
+			if err := r.SetOutput(out); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.RunWithOptions(Options{Immediate: true}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expectOutput(t, out.String(), tc.output)
+			for _, m := range tc.missing {
+				if strings.Contains(out.String(), m) {
+					t.Errorf("unexpected %q in the output:\n%s", m, out)
+				}
+			}
+		})
+	}
+}
+
+func TestSideEffects(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		keys   []string
+		output []string
+		calls  string
+	}{
+		{
+			name: "run again",
+			keys: []string{"", "", "b", "", "", ""},
+			output: []string{
+				"applied\n", "this command changes the cluster and already ran", "applied\n",
+			},
+			calls: "setup, cleanup",
+		},
+		{
+			name:   "skip",
+			keys:   []string{"", "", "b", "", "s", ""},
+			output: []string{"applied\n", "this command changes the cluster and already ran"},
+			calls:  "setup, cleanup",
+		},
+		{
+			name: "cleanup and setup",
+			keys: []string{"", "", "b", "", "c", ""},
+			output: []string{
+				"applied\n", "this command changes the cluster and already ran",
+				`Cleaning up and setting up "Title" again`, "applied\n",
+			},
+			calls: "setup, cleanup, setup, cleanup",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			typeLines(t, tc.keys...)
+			calls := []string{}
+			r := NewRun("Title")
+			r.Setup(func() error {
+				calls = append(calls, "setup")
+				return nil
+			})
+			r.Cleanup(func() error {
+				calls = append(calls, "cleanup")
+				return nil
+			})
+			r.SetSideEffects(func(command string) bool {
+				return strings.HasPrefix(command, "kubectl")
+			})
+			r.Step(S("Apply"), S(`kubectl() { printf '%s\n' applied; }; kubectl apply`))
+			r.Step(S("Done"), nil)
+
+			out := &bytes.Buffer{}
+			if err := r.SetOutput(out); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.RunWithOptions(Options{Immediate: true}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expectOutput(t, out.String(), tc.output)
+			if runs := strings.Count(out.String(), "applied\n"); runs != strings.Count(strings.Join(tc.output, ""), "applied\n") {
+				t.Errorf("unexpected number of runs %d:\n%s", runs, out)
+			}
+			if got := strings.Join(calls, ", "); got != tc.calls {
+				t.Errorf("expected the calls %q, got %q", tc.calls, got)
+			}
+		})
+	}
+}
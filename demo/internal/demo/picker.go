@@ -0,0 +1,342 @@
+package demo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/urfave/cli/v2"
+)
+
+// choice is a run to be presented, and the amount of its steps skipped.
+type choice struct {
+	run  *Run
+	skip int
+}
+
+// item is a run listed by the picker.
+type item struct {
+	*runFlag
+	selected    bool
+	skip        int
+	unavailable error
+}
+
+// picker is the full-screen menu where the presenter picks the runs to
+// present when none was selected with the flags.
+type picker struct {
+	items  []*item
+	cursor int
+
+	// steps is the item whose steps are listed, nil when listing the runs.
+	steps      *item
+	stepCursor int
+
+	offset int
+	notice string
+	width  int
+	height int
+}
+
+const (
+	pickerRunsHelp  = "↑/↓: move, space: select, a: select all, →: steps, enter: start, q: quit"
+	pickerStepsHelp = "↑/↓: move, enter: start at the step, ←: back to the runs, q: quit"
+
+	// pickerResizePoll is how often the picker checks whether the terminal
+	// was resized while waiting for a key.
+	pickerResizePoll = 250 * time.Millisecond
+)
+
+// pick shows the picker and returns the runs chosen by the presenter, in the
+// order they were added to the demo. No run is returned when they quit.
+func (d *Demo) pick(ctx *cli.Context) ([]choice, error) {
+	p := &picker{}
+	for _, x := range d.runs {
+		p.items = append(p.items, &item{runFlag: x, skip: ctx.Int(FlagSkipSteps)})
+	}
+	d.checkAvailability(ctx, p.items)
+
+	restore := rawMode()
+	defer restore()
+	// Alternate screen, without cursor.
+	write(os.Stdout, "\x1b[?1049h\x1b[?25l")       // nolint: errcheck
+	defer write(os.Stdout, "\x1b[?25h\x1b[?1049l") // nolint: errcheck
+
+	for {
+		width, height := terminalSize()
+		if width != p.width || height != p.height {
+			p.width, p.height = width, height
+			p.render()
+		}
+		key, ok, err := stdin.readChunk(pickerResizePoll)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		choices, done := p.handleKey(string(key))
+		if done {
+			return choices, nil
+		}
+		p.render()
+	}
+}
+
+// checkAvailability finds out which runs cannot start, and why. The runs are
+// checked concurrently, as checks may wait for a cluster.
+func (d *Demo) checkAvailability(ctx *cli.Context, items []*item) {
+	write(os.Stdout, "Checking which runs are available…") // nolint: errcheck
+	defer write(os.Stdout, "\r\x1b[2K")                    // nolint: errcheck
+
+	var wg sync.WaitGroup
+	for _, e := range items {
+		wg.Add(1)
+		go func(e *item) {
+			defer wg.Done()
+			e.unavailable = d.available(ctx, e.run)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// handleKey updates the picker for the key, and returns the chosen runs once
+// the presenter is done.
+func (p *picker) handleKey(key string) ([]choice, bool) {
+	p.notice = ""
+	if key == "\x03" || key == "q" || (key == "\x1b" && p.steps == nil) {
+		return nil, true
+	}
+	if p.steps != nil {
+		p.handleStepsKey(key)
+		return nil, false
+	}
+
+	current := p.items[p.cursor]
+	switch key {
+	case "\x1b[A", "k":
+		p.cursor = (p.cursor + len(p.items) - 1) % len(p.items)
+	case "\x1b[B", "j":
+		p.cursor = (p.cursor + 1) % len(p.items)
+	case " ", "x":
+		if current.unavailable != nil {
+			p.notice = fmt.Sprintf("%s is unavailable: %v", current.name(), current.unavailable)
+			break
+		}
+		current.selected = !current.selected
+	case "a":
+		all := true
+		for _, e := range p.items {
+			all = all && (e.selected || e.unavailable != nil)
+		}
+		for _, e := range p.items {
+			e.selected = !all && e.unavailable == nil
+		}
+	case "\x1b[C", "l", "\t":
+		p.steps, p.stepCursor, p.offset = current, current.skip, 0
+		if p.stepCursor >= len(current.run.steps) {
+			p.stepCursor = 0
+		}
+	case "\r", "\n":
+		return p.start()
+	default:
+		p.notice = pickerRunsHelp
+	}
+
+	return nil, false
+}
+
+func (p *picker) handleStepsKey(key string) {
+	e := p.steps
+	switch key {
+	case "\x1b[A", "k":
+		p.stepCursor = max(p.stepCursor-1, 0)
+	case "\x1b[B", "j":
+		p.stepCursor = min(p.stepCursor+1, len(e.run.steps)-1)
+	case "\x1b[D", "h", "\x1b":
+		p.steps, p.offset = nil, 0
+	case "\r", "\n", " ":
+		if e.unavailable != nil {
+			p.notice = fmt.Sprintf("%s is unavailable: %v", e.name(), e.unavailable)
+			return
+		}
+		e.selected, e.skip = true, p.stepCursor
+		p.steps, p.offset = nil, 0
+		p.notice = fmt.Sprintf("%s starts at step %d, enter starts the selected runs", e.name(), e.skip+1)
+	default:
+		p.notice = pickerStepsHelp
+	}
+}
+
+// start returns the selected runs, or the one under the cursor when none is
+// selected.
+func (p *picker) start() ([]choice, bool) {
+	choices := []choice{}
+	for _, e := range p.items {
+		if e.selected {
+			choices = append(choices, choice{e.run, e.skip})
+		}
+	}
+	if len(choices) > 0 {
+		return choices, true
+	}
+	current := p.items[p.cursor]
+	if current.unavailable != nil {
+		p.notice = fmt.Sprintf("%s is unavailable: %v", current.name(), current.unavailable)
+		return nil, false
+	}
+
+	return []choice{{current.run, current.skip}}, true
+}
+
+// render draws the whole screen, scrolling the lines so that the ones under
+// the cursor are visible.
+func (p *picker) render() {
+	var (
+		title, help string
+		lines       []string
+		from, to    int
+	)
+	if p.steps != nil {
+		title, help = p.steps.run.title, pickerStepsHelp
+		lines, from, to = p.stepLines()
+	} else {
+		title, help = "Pick the runs to present", pickerRunsHelp
+		lines, from, to = p.runLines()
+	}
+
+	// Title, its underline and a blank line above, the notice and the
+	// help below.
+	visible := max(p.height-5, 1)
+	if from < p.offset {
+		p.offset = from
+	}
+	if to > p.offset+visible {
+		p.offset = to - visible
+	}
+	end := min(p.offset+visible, len(lines))
+
+	screen := []string{
+		color.Cyan.Sprint(truncate(title, p.width)),
+		color.Cyan.Sprint(strings.Repeat("=", min(len([]rune(title)), p.width))),
+		"",
+	}
+	screen = append(screen, lines[p.offset:end]...)
+	for i := end - p.offset; i < visible; i++ {
+		screen = append(screen, "")
+	}
+	screen = append(screen,
+		color.Yellow.Sprint(truncate(p.notice, p.width)),
+		color.White.Darken().Sprint(truncate(help, p.width)),
+	)
+
+	write(os.Stdout, "\x1b[H\x1b[2J"+strings.Join(screen, "\r\n")) // nolint: errcheck
+}
+
+// runLines returns the lines listing the runs, and the range of the ones of
+// the run under the cursor.
+func (p *picker) runLines() ([]string, int, int) {
+	lines := []string{}
+	var from, to int
+	for i, e := range p.items {
+		if i == p.cursor {
+			from = len(lines)
+		}
+		cursor, box := " ", "[ ]"
+		if i == p.cursor {
+			cursor = "›"
+		}
+		if e.selected {
+			box = "[x]"
+		}
+		info := fmt.Sprintf("%d steps", len(e.run.steps))
+		if e.skip > 0 {
+			info += fmt.Sprintf(", from step %d", e.skip+1)
+		}
+		name := color.Cyan.Sprint(e.name())
+		if e.unavailable != nil {
+			name = color.White.Darken().Sprint(e.name())
+		}
+		lines = append(lines,
+			fmt.Sprintf("%s %s %s %s", cursor, box, name, color.White.Darken().Sprintf("(%s)", info)),
+			"      "+truncate(e.usage(), p.width-6),
+		)
+		if e.unavailable != nil {
+			lines = append(lines, "      "+color.Red.Sprint(truncate("unavailable: "+e.unavailable.Error(), p.width-6)))
+		}
+		if i == p.cursor {
+			to = len(lines)
+		}
+	}
+
+	return lines, from, to
+}
+
+// stepLines returns the lines describing the run whose steps are listed, and
+// listing them, and the range of the ones of the step under the cursor.
+func (p *picker) stepLines() ([]string, int, int) {
+	lines := []string{}
+	for _, d := range p.steps.run.description {
+		lines = append(lines, color.White.Darken().Sprint(truncate(d, p.width)))
+	}
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+
+	var from, to int
+	for i, s := range p.steps.run.steps {
+		if i == p.stepCursor {
+			from = len(lines)
+		}
+		cursor := " "
+		if i == p.stepCursor {
+			cursor = "›"
+		}
+		text := strings.Join(s.text, " ")
+		if text == "" {
+			text = strings.Join(s.command, " ")
+		}
+		lines = append(lines, fmt.Sprintf("%s %3d. %s", cursor, i+1, truncate(text, p.width-7)))
+		if len(s.command) > 0 && len(s.text) > 0 {
+			command := truncate("> "+strings.Join(s.command, " "), p.width-7)
+			lines = append(lines, "       "+color.Green.Sprint(command))
+		}
+		if i == p.stepCursor {
+			to = len(lines)
+		}
+	}
+
+	return lines, from, to
+}
+
+// name returns the name of the flag selecting the run.
+func (x *runFlag) name() string {
+	names := x.flag.Names()
+
+	return names[len(names)-1]
+}
+
+// usage returns the description of the run given when it was added.
+func (x *runFlag) usage() string {
+	if f, ok := x.flag.(*cli.BoolFlag); ok {
+		return f.Usage
+	}
+
+	return ""
+}
+
+// truncate shortens s to width runes, marking it with an ellipsis.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width < 1 {
+		return ""
+	}
+	if len(runes) <= width {
+		return s
+	}
+
+	return string(runes[:width-1]) + "…"
+}
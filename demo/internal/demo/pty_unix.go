@@ -0,0 +1,140 @@
+//go:build !windows
+
+package demo
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// drainTimeout is how long the output of a command is still copied once it
+// has exited, while its background processes keep the terminal open.
+const drainTimeout = 200 * time.Millisecond
+
+// isTerminal returns whether the presenter runs the demo in a terminal, the
+// steps then run in a pseudo-terminal of their own.
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// startTerminal starts the command in a new pseudo-terminal, keeping track of
+// it so that it can be killed on interrupt. The command becomes the leader of
+// a new session, and thus of a new process group.
+func (r *Run) startTerminal(cmd *exec.Cmd, size *pty.Winsize) (*os.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tty, err := pty.StartWithAttrs(cmd, size, &syscall.SysProcAttr{Setsid: true, Setctty: true})
+	if err != nil {
+		return nil, err
+	}
+	r.current = cmd
+
+	return tty, nil
+}
+
+// runInTerminal runs the command in a pseudo-terminal sized like the one of
+// the presenter, copying its output into out. The input of the presenter is
+// forwarded to the command, with their terminal in raw mode, and window size
+// changes are propagated.
+func (r *Run) runInTerminal(cmd *exec.Cmd, out io.Writer) error {
+	size, err := pty.GetsizeFull(os.Stdin)
+	if err != nil {
+		return err
+	}
+	tty, err := r.startTerminal(cmd, size)
+	if err != nil {
+		return err
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(out, tty) // nolint: errcheck
+		close(copied)
+	}()
+
+	defer rawMode()()
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	defer signal.Stop(resize)
+
+	done, forwarded := make(chan struct{}), make(chan struct{})
+	go func() {
+		stdin.forward(tty, done)
+		close(forwarded)
+	}()
+	go func() {
+		for {
+			select {
+			case <-resize:
+				pty.InheritSize(os.Stdin, tty) // nolint: errcheck
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = r.wait(cmd)
+	select {
+	case <-copied:
+	case <-time.After(drainTimeout):
+	}
+	close(done)
+	<-forwarded
+	tty.Close()
+	<-copied
+
+	return err
+}
+
+// cooked is the state of the terminal of the presenter before it was put in
+// raw mode for the first time.
+var cooked struct {
+	sync.Mutex
+	state *term.State
+}
+
+// rawMode puts the terminal of the presenter in raw mode, so that keys are
+// read as soon as they are pressed, and returns the function restoring it.
+func rawMode() func() {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return func() {}
+	}
+	cooked.Lock()
+	if cooked.state == nil {
+		cooked.state = state
+	}
+	cooked.Unlock()
+
+	return func() { term.Restore(fd, state) } // nolint: errcheck
+}
+
+// restoreTerminal leaves the raw mode the terminal of the presenter may be
+// in, for the demo to exit without the deferred restores running.
+func restoreTerminal() {
+	cooked.Lock()
+	defer cooked.Unlock()
+	if cooked.state != nil {
+		term.Restore(int(os.Stdin.Fd()), cooked.state) // nolint: errcheck
+	}
+}
+
+// terminalSize returns the size of the terminal of the presenter.
+func terminalSize() (width, height int) {
+	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil {
+		return 80, 24
+	}
+
+	return width, height
+}
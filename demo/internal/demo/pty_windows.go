@@ -0,0 +1,28 @@
+//go:build windows
+
+package demo
+
+import (
+	"io"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+func isTerminal() bool {
+	return false
+}
+
+func (r *Run) runInTerminal(*exec.Cmd, io.Writer) error {
+	return errors.New("pseudo-terminals are not supported on windows")
+}
+
+func rawMode() func() {
+	return func() {}
+}
+
+func restoreTerminal() {}
+
+func terminalSize() (width, height int) {
+	return 80, 24
+}
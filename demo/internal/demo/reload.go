@@ -0,0 +1,128 @@
+package demo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gookit/color"
+)
+
+// Reload replaces the title, description and steps of the run with the
+// ones of next, once the current step is over, so that a command is never
+// interrupted. The run goes on from the step with the same text as the one
+// it was about to run, when it still exists, and the changes are listed.
+// The setup and cleanup of the run are kept.
+func (r *Run) Reload(next *Run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = next
+}
+
+// reload applies a pending reload, and returns the index of the step to go
+// on from, instead of i.
+func (r *Run) reload(i int) int {
+	r.mu.Lock()
+	next := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if next == nil {
+		return i
+	}
+
+	changes := diffSteps(r.steps, next.steps)
+	resume := min(i, len(next.steps))
+	if i < len(r.steps) {
+		for j, s := range next.steps {
+			if s.key() == r.steps[i].key() {
+				resume = j
+				break
+			}
+		}
+	}
+
+	r.title, r.description, r.defaultStepTimeout = next.title, next.description, next.defaultStepTimeout
+	r.steps = append([]step{}, next.steps...)
+	for j := range r.steps {
+		r.steps[j].r = r
+	}
+
+	if len(changes) == 0 {
+		changes = []string{"no step changed"}
+	}
+	r.report(color.Yellow, "Reloaded %q: %s", r.title, strings.Join(changes, ", "))
+	if resume < len(r.steps) {
+		write(r.out, color.Yellow.Sprintf("Going on from step %d of %d\n\n", resume+1, len(r.steps))) // nolint: errcheck
+	}
+
+	return resume
+}
+
+// key identifies a step across reloads.
+func (s *step) key() string {
+	return strings.Join(s.text, "\n")
+}
+
+// diffSteps describes how the steps changed. Steps are matched by their
+// text, and otherwise by their position.
+func diffSteps(old, next []step) []string {
+	matched := make([]int, len(next))
+	used := make([]bool, len(old))
+	for j := range next {
+		matched[j] = -1
+		for i := range old {
+			if !used[i] && old[i].key() == next[j].key() {
+				matched[j], used[i] = i, true
+				break
+			}
+		}
+	}
+	for j := range next {
+		if matched[j] < 0 && j < len(old) && !used[j] {
+			matched[j], used[j] = j, true
+		}
+	}
+
+	changes := []string{}
+	for j, i := range matched {
+		if i < 0 {
+			changes = append(changes, fmt.Sprintf("step %d added", j+1))
+			continue
+		}
+		if fields := old[i].changed(&next[j]); len(fields) > 0 {
+			changes = append(changes, fmt.Sprintf("step %d changed (%s)", j+1, strings.Join(fields, ", ")))
+		}
+	}
+	for i := range old {
+		if !used[i] {
+			changes = append(changes, fmt.Sprintf("step %d removed", i+1))
+		}
+	}
+
+	return changes
+}
+
+// changed returns the names of the settings of the step which differ in
+// next. Expectations are only compared by number.
+func (s *step) changed(next *step) []string {
+	fields := []string{}
+	for _, f := range []struct {
+		name      string
+		old, next interface{}
+	}{
+		{"text", s.text, next.text},
+		{"command", s.command, next.command},
+		{"canFail", s.canFail, next.canFail},
+		{"expectations", len(s.expectations), len(next.expectations)},
+		{"pipe", s.pipe, next.pipe},
+		{"hostEnv", s.hostEnv, next.hostEnv},
+		{"timeout", s.timeout, next.timeout},
+		{"onTimeout", s.onTimeout, next.onTimeout},
+	} {
+		if !reflect.DeepEqual(f.old, f.next) {
+			fields = append(fields, f.name)
+		}
+	}
+
+	return fields
+}
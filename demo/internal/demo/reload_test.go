@@ -0,0 +1,176 @@
+package demo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffSteps(t *testing.T) {
+	steps := func(add func(r *Run)) []step {
+		r := NewRun("Title")
+		add(r)
+		return r.steps
+	}
+	old := steps(func(r *Run) {
+		r.Step(S("First"), S("echo first"))
+		r.Step(S("Second"), S("echo second"))
+		r.Step(S("Third"), S("echo third"))
+	})
+
+	for _, tc := range []struct {
+		name    string
+		next    func(r *Run)
+		changes []string
+	}{
+		{
+			name: "unchanged",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("Second"), S("echo second"))
+				r.Step(S("Third"), S("echo third"))
+			},
+			changes: []string{},
+		},
+		{
+			name: "changed settings",
+			next: func(r *Run) {
+				r.StepCanFail(S("First"), S("echo 1st"))
+				r.StepExpect(S("Second"), S("echo second"), StdoutContains("second"))
+				r.Step(S("Third"), S("echo third"))
+				r.StepTimeout(time.Second, Continue)
+			},
+			changes: []string{
+				"step 1 changed (command, canFail)",
+				"step 2 changed (expectations)",
+				"step 3 changed (timeout, onTimeout)",
+			},
+		},
+		{
+			name: "changed text",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("Second step"), S("echo second"))
+				r.Step(S("Third"), S("echo third"))
+			},
+			changes: []string{"step 2 changed (text)"},
+		},
+		{
+			name: "added step",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("New"), S("echo new"))
+				r.Step(S("Second"), S("echo second"))
+				r.Step(S("Third"), S("echo third"))
+			},
+			changes: []string{"step 2 added"},
+		},
+		{
+			name: "removed step",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("Third"), S("echo third"))
+			},
+			changes: []string{"step 2 removed"},
+		},
+		{
+			name: "moved step",
+			next: func(r *Run) {
+				r.Step(S("Third"), S("echo third"))
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("Second"), S("echo second"))
+			},
+			changes: []string{},
+		},
+		{
+			name: "replaced steps",
+			next: func(r *Run) {
+				r.Step(S("Other"), S("echo other"))
+			},
+			changes: []string{"step 1 changed (text, command)", "step 2 removed", "step 3 removed"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if changes := diffSteps(old, steps(tc.next)); !reflect.DeepEqual(changes, tc.changes) {
+				t.Errorf("expected %q, got %q", tc.changes, changes)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		next func(r *Run)
+
+		// output has to be contained in the output of the run, in order,
+		// after the first step.
+		output []string
+	}{
+		{
+			name: "changed step",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("Second"), S("echo changed"))
+			},
+			output: []string{
+				`Reloaded "Reloaded run": step 2 changed (command)`,
+				"Going on from step 2 of 2", "# Second [2/2]:", "changed\n",
+			},
+		},
+		{
+			name: "added step before the next one",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("New"), S("echo new"))
+				r.Step(S("Second"), S("echo second"))
+			},
+			output: []string{
+				`Reloaded "Reloaded run": step 2 added`,
+				"Going on from step 3 of 3", "# Second [3/3]:", "second\n",
+			},
+		},
+		{
+			name: "removed next step",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+			},
+			output: []string{`Reloaded "Reloaded run": step 2 removed`},
+		},
+		{
+			name: "nothing changed",
+			next: func(r *Run) {
+				r.Step(S("First"), S("echo first"))
+				r.Step(S("Second"), S("echo second"))
+			},
+			output: []string{`Reloaded "Reloaded run": no step changed`, "Going on from step 2 of 2", "second\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRun("Original run")
+			r.Step(S("First"), S("echo first"))
+			// The run is reloaded while its first step runs.
+			r.AfterStep(func() error {
+				next := NewRun("Reloaded run")
+				tc.next(next)
+				r.Reload(next)
+				return nil
+			})
+			r.Step(S("Second"), S("echo second"))
+
+			out, err := runAuto(r, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			i := strings.Index(out, "\nfirst\n")
+			if i < 0 {
+				t.Fatalf("expected the first step to run, got:\n%s", out)
+			}
+			expectOutput(t, out[i:], tc.output)
+			if strings.Count(out, "\nfirst\n") != 1 {
+				t.Errorf("expected the first step to run once, got:\n%s", out)
+			}
+		})
+	}
+}
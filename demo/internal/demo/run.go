@@ -0,0 +1,632 @@
+package demo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// Every command will be executed in a new bash subshell. This is the only
+// external dependency we need.
+const bash = "bash"
+
+// Run is an abstraction for one part of the Demo. A demo can contain multiple
+// runs.
+type Run struct {
+	title       string
+	description []string
+	steps       []step
+	out         io.Writer
+	options     *Options
+	setup       func() error
+	cleanup     func() error
+	hasSetup    bool
+	hasCleanup  bool
+	header      []string
+	env         []string
+	dir         string
+	cassette    *cassette
+	fallback    *cassette
+
+	// defaultStepTimeout is the timeout of the step commands without a
+	// timeout of their own.
+	defaultStepTimeout time.Duration
+
+	mu        sync.Mutex
+	current   *exec.Cmd
+	setupDone bool
+	pending   *Run
+
+	sideEffects func(command string) bool
+
+	// ran holds the ids of the step commands which ran.
+	ran map[string]bool
+
+	// plays counts the times the command of every step ran or got
+	// replayed, to tell apart its recordings.
+	plays map[int]int
+}
+
+type step struct {
+	r             *Run
+	text, command []string
+	canFail       bool
+	expectations  []Expectation
+	after         []func() error
+	hostEnv       bool
+	pipe          bool
+	timeout       time.Duration
+	onTimeout     FailurePolicy
+}
+
+// Options specify the run options.
+type Options struct {
+	AutoTimeout      time.Duration
+	Auto             bool
+	HideDescriptions bool
+	Immediate        bool
+	SkipSteps        int
+
+	// Record is the directory where the executed steps are recorded into.
+	Record string
+
+	// Replay is the directory containing the recorded steps to be played
+	// back instead of executing them.
+	Replay string
+
+	// StepTimeout is the time every step command may take, overriding
+	// the timeouts set in code when positive.
+	StepTimeout time.Duration
+
+	// Fallback is the directory containing the recordings played back for
+	// the steps timing out with the Fallback policy.
+	Fallback string
+
+	// CleanupTimeout is the time the cleanup may take when the run gets
+	// interrupted.
+	CleanupTimeout time.Duration
+}
+
+func emptyFn() error { return nil }
+
+// NewRun creates a new run for the provided description string.
+func NewRun(title string, description ...string) *Run {
+	return &Run{
+		title:       title,
+		description: description,
+		steps:       nil,
+		out:         os.Stdout,
+		options:     nil,
+		setup:       emptyFn,
+		cleanup:     emptyFn,
+	}
+}
+
+// optionsFrom creates a new set of options from the provided context.
+func optionsFrom(ctx *cli.Context) Options {
+	return Options{
+		AutoTimeout:      ctx.Duration(FlagAutoTimeout),
+		Auto:             ctx.Bool(FlagAuto),
+		HideDescriptions: ctx.Bool(FlagHideDescriptions),
+		Immediate:        ctx.Bool(FlagImmediate),
+		SkipSteps:        ctx.Int(FlagSkipSteps),
+		Record:           ctx.String(FlagRecord),
+		Replay:           ctx.String(FlagReplay),
+		StepTimeout:      ctx.Duration(FlagStepTimeout),
+		Fallback:         ctx.String(FlagFallback),
+		CleanupTimeout:   ctx.Duration(FlagCleanupTimeout),
+	}
+}
+
+// S is a short-hand for converting string slice syntaxes.
+func S(s ...string) []string {
+	return s
+}
+
+// Title returns the title of the run.
+func (r *Run) Title() string {
+	return r.title
+}
+
+// Description returns the description of the run.
+func (r *Run) Description() []string {
+	return r.description
+}
+
+// StepInfo describes a step of a run, as it would be presented.
+type StepInfo struct {
+	// Text is the description of the step.
+	Text []string
+
+	// Command is the shell command run by the step, empty when the step
+	// only shows its description.
+	Command string
+
+	CanFail bool
+
+	// Timeout is the time the command may take, zero meaning the default
+	// step timeout of the run.
+	Timeout time.Duration
+}
+
+// Steps describes the steps of the run.
+func (r *Run) Steps() []StepInfo {
+	steps := []StepInfo{}
+	for _, s := range r.steps {
+		steps = append(steps, StepInfo{
+			Text:    s.text,
+			Command: strings.Join(s.command, " "),
+			CanFail: s.canFail,
+			Timeout: s.timeout,
+		})
+	}
+
+	return steps
+}
+
+// Commands returns the commands executed by the steps of the run.
+func (r *Run) Commands() []string {
+	commands := []string{}
+	for _, s := range r.steps {
+		if len(s.command) > 0 {
+			commands = append(commands, strings.Join(s.command, " "))
+		}
+	}
+
+	return commands
+}
+
+// SetOutput can be used to replace the default output for the Run.
+func (r *Run) SetOutput(output io.Writer) error {
+	if output == nil {
+		return errors.New("provided output is nil")
+	}
+	r.out = output
+
+	return nil
+}
+
+// Setup sets the cleanup function called before this run.
+func (r *Run) Setup(setupFn func() error) {
+	r.setup = setupFn
+	r.hasSetup = true
+}
+
+// HasSetup returns whether a setup function has been set for this run.
+func (r *Run) HasSetup() bool {
+	return r.hasSetup
+}
+
+// SetEnv sets additional environment variables, in the form KEY=value, for
+// the commands of the steps.
+func (r *Run) SetEnv(env ...string) {
+	r.env = env
+}
+
+// SetDir sets the working directory of the commands of the steps.
+func (r *Run) SetDir(dir string) {
+	r.dir = dir
+}
+
+// UseHostEnv makes the last added step run with the environment of the demo,
+// ignoring the variables set with SetEnv.
+func (r *Run) UseHostEnv() {
+	if len(r.steps) > 0 {
+		r.steps[len(r.steps)-1].hostEnv = true
+	}
+}
+
+// UsePipe makes the last added step run with its output piped, instead of
+// in a pseudo-terminal. Programs then print their output without colors nor
+// paging, and it is captured separately from the standard error, which is
+// needed by most expectations.
+func (r *Run) UsePipe() {
+	if len(r.steps) > 0 {
+		r.steps[len(r.steps)-1].pipe = true
+	}
+}
+
+// SetHeader sets additional lines shown below the title of the run.
+func (r *Run) SetHeader(lines ...string) {
+	r.header = lines
+}
+
+// Cleanup sets the cleanup function called after this run.
+func (r *Run) Cleanup(cleanupFn func() error) {
+	r.cleanup = cleanupFn
+	r.hasCleanup = true
+}
+
+// HasCleanup returns whether a cleanup function has been set for this run.
+func (r *Run) HasCleanup() bool {
+	return r.hasCleanup
+}
+
+// Step creates a new step on the provided run.
+func (r *Run) Step(text, command []string) {
+	r.steps = append(r.steps, step{r: r, text: text, command: command})
+}
+
+// StepCanFail creates a new step which can fail on execution.
+func (r *Run) StepCanFail(text, command []string) {
+	r.steps = append(r.steps, step{r: r, text: text, command: command, canFail: true})
+}
+
+// StepExpect creates a new step whose command outcome is verified against
+// the provided expectations. A zero exit code is expected unless an ExitCode
+// expectation is provided.
+func (r *Run) StepExpect(text, command []string, expectations ...Expectation) {
+	r.steps = append(r.steps, step{
+		r: r, text: text, command: command, expectations: expectations,
+	})
+}
+
+// AfterStep registers a function to be called once the command of the last
+// added step has been executed successfully, exiting with 0 and meeting its
+// expectations. It is not called when replaying.
+func (r *Run) AfterStep(fn func() error) {
+	if len(r.steps) == 0 {
+		return
+	}
+	last := &r.steps[len(r.steps)-1]
+	last.after = append(last.after, fn)
+}
+
+// Run executes the run in the provided CLI context.
+func (r *Run) Run(ctx *cli.Context) error {
+	return r.RunWithOptions(optionsFrom(ctx))
+}
+
+// RunWithOptions executes the run with the provided Options.
+func (r *Run) RunWithOptions(opts Options) (err error) {
+	if opts.Record != "" && opts.Replay != "" {
+		return errors.New("recording and replaying at the same time is not possible")
+	}
+
+	// Nothing gets executed while replaying, including setup and cleanup.
+	if opts.Replay != "" {
+		if r.cassette, err = loadCassette(opts.Replay, r.title); err != nil {
+			return err
+		}
+		return r.runSteps(opts)
+	}
+
+	r.options = &opts
+	if err := r.setup(); err != nil {
+		return err
+	}
+	r.setSetupDone(true)
+	defer r.setSetupDone(false)
+
+	if opts.Record != "" {
+		r.cassette = &cassette{Title: r.title, Recorded: time.Now()}
+		defer func() {
+			if saveErr := r.cassette.save(opts.Record); err == nil {
+				err = saveErr
+			}
+		}()
+	}
+
+	if err := r.runSteps(opts); err != nil {
+		return err
+	}
+
+	return r.cleanup()
+}
+
+func (r *Run) runSteps(opts Options) error {
+	r.options = &opts
+
+	if err := r.printTitleAndDescription(); err != nil {
+		return err
+	}
+	r.ran = map[string]bool{}
+	r.plays = map[int]int{}
+	last := -1
+	for i := r.options.SkipSteps; i < len(r.steps); {
+		if i = r.reload(i); i >= len(r.steps) {
+			break
+		}
+		nav, err := r.steps[i].run(i+1, len(r.steps))
+		if err != nil {
+			return err
+		}
+		switch nav.move {
+		case moveBack:
+			i = max(i-1, 0)
+		case moveJump:
+			i = nav.step
+		case moveRepeat:
+			if err := r.repeat(last); err != nil {
+				return err
+			}
+		default:
+			if len(r.steps[i].command) > 0 {
+				last = i
+			}
+			i++
+		}
+	}
+
+	return nil
+}
+
+func (r *Run) printTitleAndDescription() error {
+	if err := write(r.out, color.Cyan.Sprintf("%s\n", r.title)); err != nil {
+		return err
+	}
+	for range r.title {
+		if err := write(r.out, color.Cyan.Sprint("=")); err != nil {
+			return err
+		}
+	}
+	if err := write(r.out, "\n"); err != nil {
+		return err
+	}
+	for _, h := range r.header {
+		if err := write(r.out, color.Yellow.Sprintf("%s\n", h)); err != nil {
+			return err
+		}
+	}
+	if !r.options.HideDescriptions {
+		for _, d := range r.description {
+			if err := write(
+				r.out, color.White.Darken().Sprintf("%s\n", d),
+			); err != nil {
+				return err
+			}
+		}
+		if err := write(r.out, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func write(w io.Writer, str string) error {
+	_, err := w.Write([]byte(str))
+
+	return err
+}
+
+// run presents the step, unless the presenter navigates somewhere else
+// first.
+func (s *step) run(current, max int) (navigation, error) {
+	nav, err := s.r.prompt(false)
+	if err != nil {
+		return next, errors.Wrapf(err, "unable to run step: %v", s)
+	}
+	if nav.move != moveNext {
+		return nav, nil
+	}
+	if len(s.text) > 0 && !s.r.options.HideDescriptions {
+		s.echo(current, max)
+	}
+	succeeded := false
+	if len(s.command) > 0 {
+		if nav, succeeded, err = s.execute(current, true); err != nil || nav.move != moveNext {
+			return nav, err
+		}
+	}
+	if s.r.options.Replay != "" || (len(s.command) > 0 && !succeeded) {
+		return next, nil
+	}
+	for _, fn := range s.after {
+		if err := fn(); err != nil {
+			return next, errors.Wrap(err, "step hook failed")
+		}
+	}
+
+	return next, nil
+}
+
+func (s *step) echo(current, max int) {
+	prepared := []string{}
+	for i, x := range s.text {
+		if i == len(s.text)-1 {
+			prepared = append(
+				prepared,
+				color.White.Darken().Sprintf(
+					"# %s [%d/%d]:\n",
+					x, current, max,
+				),
+			)
+		} else {
+			m := color.White.Darken().Sprintf("# %s", x)
+			prepared = append(prepared, m)
+		}
+	}
+	s.print(prepared...)
+}
+
+// execute shows the command of the step, waiting for the presenter before
+// running it when asked to. Commands with side effects which already ran are
+// only run again once the presenter confirms it. It returns whether the
+// command actually ran and succeeded, instead of failing, being replayed or
+// skipped.
+func (s *step) execute(current int, wait bool) (navigation, bool, error) {
+	cmdString := color.Green.Sprintf("> %s", strings.Join(s.command, " \\\n    "))
+	s.print(cmdString)
+
+	rerun := s.r.ran[s.id()] && s.hasSideEffects()
+	if rerun {
+		s.print(color.Yellow.Sprint(
+			"# this command changes the cluster and already ran: " +
+				"enter runs it again, s skips it, c cleans up and runs the setup first",
+		))
+	}
+	if wait || rerun {
+		nav, err := s.r.prompt(rerun)
+		if err != nil {
+			return next, false, errors.Wrapf(err, "unable to execute step: %v", s)
+		}
+		switch nav.move {
+		case moveNext:
+		case moveSkip:
+			s.print("")
+			return next, false, nil
+		case moveReset:
+			if err := s.r.resetup(); err != nil {
+				return next, false, err
+			}
+		default:
+			return nav, false, nil
+		}
+	}
+
+	executed, succeeded, err := s.runOnce(current)
+	if executed {
+		s.r.ran[s.id()] = true
+	}
+
+	return next, succeeded, err
+}
+
+// runOnce runs, or replays, the command of the step and checks its outcome.
+// It returns whether the command actually ran, and whether it succeeded too,
+// exiting with 0 and meeting the expectations of the step.
+func (s *step) runOnce(current int) (executed, succeeded bool, err error) {
+	defer func() { s.r.plays[current]++ }()
+
+	var outcome *Outcome
+	if s.r.options.Replay != "" {
+		outcome, err = s.replay(current)
+	} else {
+		outcome, err = s.runCommand(current)
+		executed = err == nil
+		if timeout, ok := err.(*timeoutError); ok {
+			outcome, err = s.timedOut(current, timeout)
+			if outcome == nil && err == nil {
+				s.print("")
+				return false, false, nil
+			}
+		}
+	}
+	if err != nil {
+		return false, false, errors.Wrap(err, "step command failed")
+	}
+	succeeded = executed && outcome.ExitCode == 0
+	if len(s.expectations) > 0 {
+		met, err := s.check(outcome)
+		return executed, succeeded && met, err
+	}
+	if s.canFail {
+		return executed, succeeded, nil
+	}
+	s.print("")
+
+	if outcome.ExitCode != 0 {
+		return false, false, errors.Errorf("step command failed: exit status %d", outcome.ExitCode)
+	}
+
+	return executed, succeeded, nil
+}
+
+func (s *step) runCommand(current int) (*Outcome, error) {
+	joinedCommand := strings.Join(s.command, " ")
+	cmd := exec.Command(bash, "-c", joinedCommand)
+	if !s.hostEnv && len(s.r.env) > 0 {
+		cmd.Env = append(os.Environ(), s.r.env...)
+	}
+	cmd.Dir = s.r.dir
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	rec := newRecorder()
+	disarm := s.r.armTimeout(s.commandTimeout())
+	var err error
+	if !s.pipe && isTerminal() {
+		// The pseudo-terminal merges both streams into stdout.
+		out := io.MultiWriter(s.r.out, stdout)
+		if s.r.cassette != nil {
+			out = io.MultiWriter(out, rec.stream(streamStdout))
+		}
+		err = s.r.runInTerminal(cmd, out)
+	} else {
+		err = s.runPiped(cmd, stdout, stderr, rec)
+	}
+	if timeout := disarm(); timeout != nil {
+		return nil, timeout
+	}
+
+	outcome := &Outcome{}
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, err
+		}
+		outcome.ExitCode = exitErr.ExitCode()
+	}
+	outcome.Stdout = stdout.String()
+	outcome.Stderr = stderr.String()
+
+	if s.r.cassette != nil {
+		s.r.cassette.Tracks = append(s.r.cassette.Tracks, &track{
+			Step:       current,
+			Occurrence: s.r.plays[current],
+			Command:    joinedCommand,
+			ExitCode:   outcome.ExitCode,
+			Duration:   time.Since(rec.start),
+			Output:     rec.output,
+		})
+	}
+
+	return outcome, nil
+}
+
+func (s *step) runPiped(cmd *exec.Cmd, stdout, stderr io.Writer, rec *recorder) error {
+	setProcessGroup(cmd)
+	cmd.Stdout = io.MultiWriter(s.r.out, stdout)
+	cmd.Stderr = io.MultiWriter(s.r.out, stderr)
+	if s.r.cassette != nil {
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, rec.stream(streamStdout))
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, rec.stream(streamStderr))
+	}
+	if err := s.r.start(cmd); err != nil {
+		return err
+	}
+
+	return s.r.wait(cmd)
+}
+
+func (s *step) replay(current int) (*Outcome, error) {
+	t := s.r.cassette.track(current, s.r.plays[current])
+	if t == nil {
+		return nil, errors.Errorf("no recording available for step %d", current)
+	}
+	if joinedCommand := strings.Join(s.command, " "); t.Command != joinedCommand {
+		s.print(color.Yellow.Sprintf(
+			"# recorded command differs: %s", t.Command,
+		))
+	}
+
+	return t.play(s.r)
+}
+
+func (s *step) print(msg ...string) error {
+	for _, m := range msg {
+		for _, c := range m {
+			if !s.r.options.Immediate {
+				time.Sleep(time.Duration(rand.Intn(40)) * time.Millisecond) // nolint: gosec
+			}
+			if err := write(s.r.out, fmt.Sprintf("%c", c)); err != nil {
+				return err
+			}
+		}
+		if err := write(s.r.out, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package demo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+	// The output of the runs is compared without colors.
+	color.Disable()
+	os.Exit(m.Run())
+}
+
+// runAuto runs r automatically and at once, and returns its output.
+func runAuto(r *Run, opts Options) (string, error) {
+	out := &bytes.Buffer{}
+	if err := r.SetOutput(out); err != nil {
+		return "", err
+	}
+	opts.Auto, opts.Immediate = true, true
+	err := r.RunWithOptions(opts)
+
+	return out.String(), err
+}
+
+// expectOutput verifies that out contains every expected string, in order.
+func expectOutput(t *testing.T, out string, expected []string) {
+	t.Helper()
+	rest := out
+	for _, e := range expected {
+		i := strings.Index(rest, e)
+		if i < 0 {
+			t.Fatalf("expected %q in the output, got:\n%s", e, out)
+		}
+		rest = rest[i+len(e):]
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		steps func(r *Run)
+		opts  Options
+
+		// output has to be contained in the output of the run, in order,
+		// and missing must not.
+		output  []string
+		missing []string
+		err     string
+	}{
+		{
+			name: "steps",
+			steps: func(r *Run) {
+				r.Step(S("First step"), S("echo hello"))
+				r.Step(S("Second step", "with two lines"), S("echo", "world"))
+				r.Step(S("Text only"), nil)
+			},
+			output: []string{
+				"Title\n=====", "A description",
+				"# First step [1/3]:", "> echo hello", "hello\n",
+				"# Second step", "# with two lines [2/3]:", "> echo \\\n    world", "world\n",
+				"# Text only [3/3]:",
+			},
+		},
+		{
+			name: "failing step",
+			steps: func(r *Run) {
+				r.Step(S("First step"), S("exit 3"))
+				r.Step(S("Second step"), S("echo never"))
+			},
+			missing: []string{"Second step"},
+			err:     "step command failed: exit status 3",
+		},
+		{
+			name: "step that can fail",
+			steps: func(r *Run) {
+				r.StepCanFail(S("First step"), S("echo failing; exit 3"))
+				r.Step(S("Second step"), S("echo after"))
+			},
+			output: []string{"failing\n", "after\n"},
+		},
+		{
+			name: "skipped steps",
+			steps: func(r *Run) {
+				r.Step(S("First step"), S("echo first"))
+				r.Step(S("Second step"), S("echo second"))
+			},
+			opts:    Options{SkipSteps: 1},
+			output:  []string{"# Second step [2/2]:", "second\n"},
+			missing: []string{"First step", "first\n"},
+		},
+		{
+			name: "hidden descriptions",
+			steps: func(r *Run) {
+				r.Step(S("First step"), S("echo first"))
+			},
+			opts:    Options{HideDescriptions: true},
+			output:  []string{"> echo first", "first\n"},
+			missing: []string{"A description", "First step"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRun("Title", "A description")
+			tc.steps(r)
+			out, err := runAuto(r, tc.opts)
+			if tc.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+			expectOutput(t, out, tc.output)
+			for _, m := range tc.missing {
+				if strings.Contains(out, m) {
+					t.Errorf("unexpected %q in the output:\n%s", m, out)
+				}
+			}
+		})
+	}
+}
+
+func TestSetupAndCleanup(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		setupErr error
+		command  string
+		calls    []string
+		err      string
+	}{
+		{
+			name:    "successful run",
+			command: "true",
+			calls:   []string{"setup", "step", "cleanup"},
+		},
+		{
+			name:    "failing step",
+			command: "false",
+			calls:   []string{"setup", "step"},
+			err:     "step command failed",
+		},
+		{
+			name:     "failing setup",
+			setupErr: errors.New("no cluster"),
+			command:  "true",
+			calls:    []string{"setup"},
+			err:      "no cluster",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			log := filepath.Join(t.TempDir(), "calls")
+			call := func(name string) error {
+				f, err := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				_, err = f.WriteString(name + "\n")
+				return err
+			}
+
+			r := NewRun("Title")
+			r.Setup(func() error {
+				if err := call("setup"); err != nil {
+					return err
+				}
+				return tc.setupErr
+			})
+			r.Cleanup(func() error { return call("cleanup") })
+			r.Step(S("Step"), S("echo step >> "+log+" &&", tc.command))
+
+			_, err := runAuto(r, Options{})
+			if tc.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+			content, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls := strings.Fields(string(content)); !reflect.DeepEqual(calls, tc.calls) {
+				t.Errorf("expected the calls %v, got %v", tc.calls, calls)
+			}
+		})
+	}
+}
+
+func TestAfterStep(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		step   func(r *Run)
+		called bool
+	}{
+		{
+			name:   "successful command",
+			step:   func(r *Run) { r.Step(S("Step"), S("true")) },
+			called: true,
+		},
+		{
+			name: "failing command that can fail",
+			step: func(r *Run) { r.StepCanFail(S("Step"), S("exit 3")) },
+		},
+		{
+			name: "expected failing command",
+			step: func(r *Run) { r.StepExpect(S("Step"), S("exit 3"), ExitCode(3)) },
+		},
+		{
+			name:   "met expectations",
+			step:   func(r *Run) { r.StepExpect(S("Step"), S("echo hello"), StdoutContains("hello")) },
+			called: true,
+		},
+		{
+			name: "unmet expectations",
+			step: func(r *Run) { r.StepExpect(S("Step"), S("echo hello"), StdoutContains("bye")) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Outside of the auto mode, unmet expectations do not stop the
+			// run.
+			typeLines(t, "", "")
+			r := NewRun("Title")
+			tc.step(r)
+			called := false
+			r.AfterStep(func() error {
+				called = true
+				return nil
+			})
+			if err := r.SetOutput(&bytes.Buffer{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.RunWithOptions(Options{Immediate: true}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if called != tc.called {
+				t.Errorf("expected the hook to be called: %v, got %v", tc.called, called)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package demo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+)
+
+// FailurePolicy is what a run does when a step command times out.
+type FailurePolicy int
+
+const (
+	// Abort stops the run.
+	Abort FailurePolicy = iota
+
+	// Continue goes on with the next step.
+	Continue
+
+	// Fallback plays back the output recorded for the step, from the
+	// cassettes of the Fallback directory, as if the command had
+	// finished.
+	Fallback
+)
+
+// timeoutError is returned when a step command gets killed for taking too
+// long.
+type timeoutError struct {
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("step timed out after %s", e.after)
+}
+
+// SetDefaultStepTimeout sets the time each step command of the run may take,
+// unless the step has a timeout of its own. It is not a deadline for the
+// whole run, which may take as long as all of its steps together. There is
+// no timeout by default.
+func (r *Run) SetDefaultStepTimeout(timeout time.Duration) {
+	r.defaultStepTimeout = timeout
+}
+
+// DefaultStepTimeout returns the time each step command of the run may take
+// when it has no timeout of its own, zero meaning forever.
+func (r *Run) DefaultStepTimeout() time.Duration {
+	return r.defaultStepTimeout
+}
+
+// StepTimeout sets the time the command of the last added step may take,
+// and what to do once it gets killed for exceeding it. A zero timeout keeps
+// the one of the run.
+func (r *Run) StepTimeout(timeout time.Duration, policy FailurePolicy) {
+	if len(r.steps) > 0 {
+		last := &r.steps[len(r.steps)-1]
+		last.timeout, last.onTimeout = timeout, policy
+	}
+}
+
+// commandTimeout returns the time the step command may take, zero meaning
+// forever. The StepTimeout option overrides the timeouts set in code.
+func (s *step) commandTimeout() time.Duration {
+	switch {
+	case s.r.options.StepTimeout > 0:
+		return s.r.options.StepTimeout
+	case s.timeout > 0:
+		return s.timeout
+	}
+
+	return s.r.defaultStepTimeout
+}
+
+// armTimeout kills the running step command, along with all its child
+// processes, once the timeout expires. The returned function disarms it and
+// returns the timeout error when it fired.
+func (r *Run) armTimeout(timeout time.Duration) func() error {
+	if timeout <= 0 {
+		return func() error { return nil }
+	}
+	fired, killed := make(chan struct{}), false
+	timer := time.AfterFunc(timeout, func() {
+		defer close(fired)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.current != nil {
+			killed = killProcessGroup(r.current) == nil
+		}
+	})
+
+	return func() error {
+		if timer.Stop() {
+			return nil
+		}
+		<-fired
+		if !killed {
+			return nil
+		}
+		return &timeoutError{after: timeout}
+	}
+}
+
+// timedOut follows the failure policy of the step once its command timed
+// out. It returns the outcome to go on with, which is nil when the step has
+// to be skipped.
+func (s *step) timedOut(current int, timeout *timeoutError) (*Outcome, error) {
+	s.print(color.Red.Sprint(timeout.Error()))
+
+	switch s.onTimeout {
+	case Continue:
+		return nil, nil
+	case Fallback:
+		return s.fallback(current, timeout)
+	}
+
+	return nil, timeout
+}
+
+// fallback plays back the output recorded for the step.
+func (s *step) fallback(current int, timeout *timeoutError) (*Outcome, error) {
+	if s.r.options.Fallback == "" {
+		return nil, errors.Wrap(timeout, "no fallback recordings are available")
+	}
+	if s.r.fallback == nil {
+		c, err := loadCassette(s.r.options.Fallback, s.r.title)
+		if err != nil {
+			return nil, errors.Wrap(err, timeout.Error())
+		}
+		s.r.fallback = c
+	}
+	t := s.r.fallback.track(current, s.r.plays[current])
+	if t == nil {
+		return nil, errors.Wrapf(timeout, "no recording available for step %d", current)
+	}
+	s.print(color.Yellow.Sprintf(
+		"# playing back the output recorded on %s",
+		s.r.fallback.Recorded.Format("2006-01-02 15:04"),
+	))
+
+	return t.play(s.r)
+}
@@ -0,0 +1,133 @@
+package demo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		run, step, option time.Duration
+		expected          time.Duration
+	}{
+		{name: "none"},
+		{name: "run", run: time.Minute, expected: time.Minute},
+		{name: "step", run: time.Minute, step: time.Second, expected: time.Second},
+		{name: "option", run: time.Minute, step: time.Second, option: time.Hour, expected: time.Hour},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRun("Title")
+			r.SetDefaultStepTimeout(tc.run)
+			r.Step(S("Step"), S("true"))
+			r.StepTimeout(tc.step, Abort)
+			r.options = &Options{StepTimeout: tc.option}
+			if got := r.steps[0].commandTimeout(); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	// The fallback cassette holds the output of the second step, recorded
+	// when it did not time out.
+	fallback := t.TempDir()
+	recorded := NewRun("Slow run")
+	recorded.Step(S("First step"), S("echo first"))
+	recorded.Step(S("Slow step"), S("echo recorded output"))
+	if _, err := runAuto(recorded, Options{Record: fallback}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		title  string
+		policy FailurePolicy
+		opts   Options
+
+		// timeout is set as the default step timeout when policy is
+		// Abort, and as the one of the slow step otherwise.
+		timeout time.Duration
+
+		output []string
+		err    string
+	}{
+		{
+			name:    "abort",
+			policy:  Abort,
+			timeout: 100 * time.Millisecond,
+			output:  []string{"step timed out after 100ms"},
+			err:     "step command failed: step timed out after 100ms",
+		},
+		{
+			name:    "continue",
+			policy:  Continue,
+			timeout: 100 * time.Millisecond,
+			output:  []string{"step timed out after 100ms", "# Last step [3/3]:"},
+		},
+		{
+			name:    "option",
+			policy:  Continue,
+			timeout: time.Hour,
+			opts:    Options{StepTimeout: 100 * time.Millisecond},
+			output:  []string{"step timed out after 100ms", "# Last step [3/3]:"},
+		},
+		{
+			name:    "fallback",
+			policy:  Fallback,
+			timeout: 100 * time.Millisecond,
+			opts:    Options{Fallback: fallback},
+			output: []string{
+				"step timed out after 100ms", "# playing back the output recorded on ",
+				"recorded output\n", "# Last step [3/3]:",
+			},
+		},
+		{
+			name:    "fallback without recordings",
+			policy:  Fallback,
+			timeout: 100 * time.Millisecond,
+			err:     "no fallback recordings are available: step timed out after 100ms",
+		},
+		{
+			name:    "fallback without cassette",
+			title:   "Other run",
+			policy:  Fallback,
+			timeout: 100 * time.Millisecond,
+			opts:    Options{Fallback: fallback},
+			err:     "step timed out after 100ms: unable to read cassette",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			title := tc.title
+			if title == "" {
+				title = "Slow run"
+			}
+			r := NewRun(title)
+			r.Step(S("First step"), S("echo first"))
+			// The background process would keep the output open if it
+			// was not killed along with the step command.
+			r.Step(S("Slow step"), S("sleep 10 & sleep 10"))
+			if tc.policy == Abort {
+				r.SetDefaultStepTimeout(tc.timeout)
+			} else {
+				r.StepTimeout(tc.timeout, tc.policy)
+			}
+			r.Step(S("Last step"), nil)
+
+			start := time.Now()
+			out, err := runAuto(r, tc.opts)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the slow step to be killed, the run took %s", elapsed)
+			}
+			if tc.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+			expectOutput(t, out, tc.output)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package kubewarden
+
+// knownAPIs are the resources of the well-known API groups, to spot typos in
+// the rules of the policies. The core group is the empty one.
+var knownAPIs = map[string][]string{
+	"": {
+		"bindings", "componentstatuses", "configmaps", "endpoints", "events",
+		"limitranges", "namespaces", "nodes", "persistentvolumeclaims",
+		"persistentvolumes", "pods", "podtemplates", "replicationcontrollers",
+		"resourcequotas", "secrets", "serviceaccounts", "services",
+	},
+	"admissionregistration.k8s.io": {
+		"mutatingwebhookconfigurations", "validatingwebhookconfigurations",
+	},
+	"apiextensions.k8s.io": {"customresourcedefinitions"},
+	"apps": {
+		"controllerrevisions", "daemonsets", "deployments", "replicasets",
+		"statefulsets",
+	},
+	"autoscaling":         {"horizontalpodautoscalers"},
+	"batch":               {"cronjobs", "jobs"},
+	"cert-manager.io":     {"certificaterequests", "certificates", "clusterissuers", "issuers"},
+	"coordination.k8s.io": {"leases"},
+	"discovery.k8s.io":    {"endpointslices"},
+	"extensions":          {"daemonsets", "deployments", "ingresses", "networkpolicies", "replicasets"},
+	"networking.k8s.io":   {"ingressclasses", "ingresses", "networkpolicies"},
+	"node.k8s.io":         {"runtimeclasses"},
+	"policies.kubewarden.io": {
+		"admissionpolicies", "clusteradmissionpolicies", "policyservers",
+	},
+	"policy": {"poddisruptionbudgets", "podsecuritypolicies"},
+	"rbac.authorization.k8s.io": {
+		"clusterrolebindings", "clusterroles", "rolebindings", "roles",
+	},
+	"scheduling.k8s.io": {"priorityclasses"},
+	"storage.k8s.io": {
+		"csidrivers", "csinodes", "csistoragecapacities", "storageclasses",
+		"volumeattachments",
+	},
+}
+
+func knownGroup(group string) bool {
+	_, ok := knownAPIs[group]
+
+	return ok
+}
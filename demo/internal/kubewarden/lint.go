@@ -0,0 +1,491 @@
+package kubewarden
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+// The API group of the Kubewarden policies.
+const policyGroup = "policies.kubewarden.io"
+
+// The policies.kubewarden.io versions, and the kinds they serve.
+var apiVersions = map[string][]string{
+	"policies.kubewarden.io/v1alpha2": {ClusterAdmissionPolicy, AdmissionPolicy},
+	"policies.kubewarden.io/v1":       {ClusterAdmissionPolicy, AdmissionPolicy},
+}
+
+// The fields of the spec of a policy, namespaceSelector is only available
+// for cluster wide policies.
+var specFields = []string{
+	"module", "settings", "rules", "mutating", "policyServer", "failurePolicy",
+	"objectSelector", "namespaceSelector", "sideEffects", "timeoutSeconds",
+	"matchPolicy", "mode",
+}
+
+var ruleFields = []string{"apiGroups", "apiVersions", "resources", "operations", "scope"}
+
+// The module URI schemes understood by the policy-server.
+var moduleSchemes = []string{"registry", "https", "file"}
+
+var (
+	versionRegexp  = regexp.MustCompile(`^v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`)
+	resourceRegexp = regexp.MustCompile(`^([a-z0-9.-]+|\*)(/([a-z0-9.-]+|\*))?$`)
+)
+
+// Problem is an issue found in a policy manifest.
+type Problem struct {
+	File   string
+	Line   int
+	Column int
+
+	// Path is the YAML path of the offending node, e.g.
+	// `spec.rules[0].operations[1]`.
+	Path    string
+	Message string
+
+	// Warning problems do not prevent the policy from working, but are
+	// likely mistakes.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	severity := "error"
+	if p.Warning {
+		severity = "warning"
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s: %s: %s", p.File, p.Line, p.Column, severity, p.Path, p.Message)
+}
+
+// Errors returns the number of problems which are not warnings.
+func Errors(problems []Problem) int {
+	errs := 0
+	for _, p := range problems {
+		if !p.Warning {
+			errs++
+		}
+	}
+
+	return errs
+}
+
+// ContainsPolicy returns whether any document of the YAML file at path is a
+// Kubewarden policy, by its policies.kubewarden.io API group, whichever its
+// kind or version is.
+func ContainsPolicy(path string) (bool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to read manifest")
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var meta struct {
+			APIVersion string `yaml:"apiVersion"`
+		}
+		if err := dec.Decode(&meta); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrapf(err, "invalid manifest %s", path)
+		}
+		if isPolicyGroup(meta.APIVersion) {
+			return true, nil
+		}
+	}
+}
+
+func isPolicyGroup(apiVersion string) bool {
+	return strings.SplitN(apiVersion, "/", 2)[0] == policyGroup
+}
+
+// Lint verifies the policy manifests of the YAML file at path. Documents
+// which are not Kubewarden policies are ignored.
+func Lint(path string) ([]Problem, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read manifest")
+	}
+	l := &linter{file: path}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	policies := 0
+	for {
+		doc := &yaml.Node{}
+		if err := dec.Decode(doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "invalid manifest %s", path)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		if l.policy(doc.Content[0]) {
+			policies++
+		}
+	}
+	if policies == 0 {
+		return nil, errors.Errorf("%s contains no Kubewarden policy", path)
+	}
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+
+	return l.problems, nil
+}
+
+type linter struct {
+	file     string
+	problems []Problem
+}
+
+func (l *linter) report(n *yaml.Node, path string, warning bool, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		File:    l.file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+		Warning: warning,
+	})
+}
+
+func (l *linter) errorf(n *yaml.Node, path, format string, args ...interface{}) {
+	l.report(n, path, false, format, args...)
+}
+
+func (l *linter) warnf(n *yaml.Node, path, format string, args ...interface{}) {
+	l.report(n, path, true, format, args...)
+}
+
+// policy lints a document, it returns false when it is not a Kubewarden
+// policy.
+func (l *linter) policy(doc *yaml.Node) bool {
+	if doc.Kind != yaml.MappingNode {
+		return false
+	}
+	apiVersion, kind := field(doc, "apiVersion"), field(doc, "kind")
+	if apiVersion == nil || !isPolicyGroup(apiVersion.Value) {
+		return false
+	}
+	if kind == nil {
+		l.errorf(doc, "kind", "missing, expected one of %s, %s", ClusterAdmissionPolicy, AdmissionPolicy)
+		return true
+	}
+
+	kinds, ok := apiVersions[apiVersion.Value]
+	if !ok {
+		l.errorf(apiVersion, "apiVersion", "unsupported version %s, expected one of %s",
+			apiVersion.Value, strings.Join(sortedKeys(apiVersions), ", "))
+	} else if !contains(kinds, kind.Value) {
+		l.errorf(kind, "kind", "unsupported kind %s, expected one of %s%s",
+			kind.Value, strings.Join(kinds, ", "), suggest(kind.Value, kinds))
+	}
+
+	if metadata := l.mapping(doc, "", "metadata", true); metadata != nil {
+		if name := field(metadata, "name"); name == nil || name.Value == "" {
+			l.errorf(metadata, "metadata.name", "missing")
+		}
+	}
+
+	spec := l.mapping(doc, "", "spec", true)
+	if spec == nil {
+		return true
+	}
+	fields := specFields
+	if kind.Value == AdmissionPolicy {
+		fields = without(fields, "namespaceSelector")
+	}
+	l.unknownFields(spec, "spec", fields)
+
+	module := l.module(spec)
+	l.settings(spec, module)
+	l.rules(spec)
+	if mutating := field(spec, "mutating"); mutating == nil {
+		l.errorf(spec, "spec.mutating", "missing, it has to be true or false")
+	} else if mutating.Tag != "!!bool" {
+		l.errorf(mutating, "spec.mutating", "%q is not a boolean, it has to be true or false", mutating.Value)
+	}
+	if failurePolicy := field(spec, "failurePolicy"); failurePolicy != nil &&
+		failurePolicy.Value != "Fail" && failurePolicy.Value != "Ignore" {
+		l.errorf(failurePolicy, "spec.failurePolicy", "%q is not Fail nor Ignore", failurePolicy.Value)
+	}
+
+	return true
+}
+
+func (l *linter) module(spec *yaml.Node) string {
+	module := field(spec, "module")
+	if module == nil || module.Value == "" {
+		l.errorf(spec, "spec.module", "missing")
+		return ""
+	}
+	u, err := url.Parse(module.Value)
+	if err != nil {
+		l.errorf(module, "spec.module", "invalid URI: %v", err)
+		return ""
+	}
+	switch u.Scheme {
+	case "registry", "https":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			l.errorf(module, "spec.module", "%s URI %q has no host or path", u.Scheme, module.Value)
+		}
+	case "file":
+		if u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+			l.errorf(module, "spec.module", "file URI %q must be absolute, like file:///path/policy.wasm", module.Value)
+		}
+	case "":
+		l.errorf(module, "spec.module", "%q has no scheme, expected one of %s://",
+			module.Value, strings.Join(moduleSchemes, "://, "))
+	default:
+		l.errorf(module, "spec.module", "unsupported scheme %s, expected one of %s%s",
+			u.Scheme, strings.Join(moduleSchemes, ", "), suggest(u.Scheme, moduleSchemes))
+	}
+
+	return module.Value
+}
+
+func (l *linter) settings(spec *yaml.Node, module string) {
+	settings := l.mapping(spec, "spec", "settings", false)
+	if settings == nil {
+		return
+	}
+	keys, ok := policy.SettingsKeys(module)
+	if !ok {
+		return
+	}
+	before := len(l.problems)
+	l.unknownFields(settings, "spec.settings", keys)
+	if len(l.problems) > before {
+		return
+	}
+
+	var v interface{}
+	if err := settings.Decode(&v); err != nil {
+		l.errorf(settings, "spec.settings", "%v", err)
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		l.errorf(settings, "spec.settings", "%v", err)
+		return
+	}
+	if err := policy.ValidateSettings(module, raw); err != nil {
+		l.errorf(settings, "spec.settings", "%v", err)
+	}
+}
+
+func (l *linter) rules(spec *yaml.Node) {
+	rules := field(spec, "rules")
+	if rules == nil || (rules.Kind == yaml.SequenceNode && len(rules.Content) == 0) {
+		l.errorf(spec, "spec.rules", "missing, the policy would not be evaluated for any request")
+		return
+	}
+	if rules.Kind != yaml.SequenceNode {
+		l.errorf(rules, "spec.rules", "not a list")
+		return
+	}
+
+	for i, rule := range rules.Content {
+		path := fmt.Sprintf("spec.rules[%d]", i)
+		if rule.Kind != yaml.MappingNode {
+			l.errorf(rule, path, "not a mapping")
+			continue
+		}
+		l.unknownFields(rule, path, ruleFields)
+
+		groups := l.strings(rule, path, "apiGroups")
+		versions := l.strings(rule, path, "apiVersions")
+		resources := l.strings(rule, path, "resources")
+		operations := l.strings(rule, path, "operations")
+
+		for j, g := range groups {
+			if g.Value != "*" && g.Value != "" && !knownGroup(g.Value) {
+				l.warnf(g, fmt.Sprintf("%s.apiGroups[%d]", path, j),
+					"%s is not a well-known API group, make sure the cluster serves it%s",
+					g.Value, suggest(g.Value, sortedKeys(knownAPIs)))
+			}
+		}
+		for j, v := range versions {
+			vpath := fmt.Sprintf("%s.apiVersions[%d]", path, j)
+			switch {
+			case v.Value == "*":
+			case strings.Contains(v.Value, "/"):
+				l.errorf(v, vpath, "%s includes the group, which belongs to apiGroups", v.Value)
+			case !versionRegexp.MatchString(v.Value):
+				l.errorf(v, vpath, "%s is not a valid version, like v1 or v1beta1", v.Value)
+			}
+		}
+		for j, r := range resources {
+			rpath := fmt.Sprintf("%s.resources[%d]", path, j)
+			if !resourceRegexp.MatchString(r.Value) {
+				l.errorf(r, rpath, "%s is not a valid resource, like ingresses or pods/exec", r.Value)
+				continue
+			}
+			for _, g := range groups {
+				known, ok := knownAPIs[g.Value]
+				name := strings.Split(r.Value, "/")[0]
+				if ok && name != "*" && !contains(known, name) {
+					l.warnf(r, rpath, "%s is not a resource of the %q API group%s",
+						r.Value, g.Value, suggest(name, known))
+				}
+			}
+		}
+		for j, o := range operations {
+			if !contains([]string{admission.Create, admission.Update, admission.Delete, admission.Connect, "*"}, o.Value) {
+				l.errorf(o, fmt.Sprintf("%s.operations[%d]", path, j),
+					"%s is not an operation, expected one of CREATE, UPDATE, DELETE, CONNECT or *%s",
+					o.Value, suggest(strings.ToUpper(o.Value), []string{admission.Create, admission.Update, admission.Delete, admission.Connect}))
+			}
+		}
+	}
+}
+
+// strings returns the items of the list of strings key of n, which must be
+// present and not empty.
+func (l *linter) strings(n *yaml.Node, path, key string) []*yaml.Node {
+	path += "." + key
+	list := field(n, key)
+	switch {
+	case list == nil:
+		l.errorf(n, path, "missing")
+		return nil
+	case list.Kind != yaml.SequenceNode:
+		l.errorf(list, path, "not a list")
+		return nil
+	case len(list.Content) == 0:
+		l.errorf(list, path, "empty, the rule would never match")
+		return nil
+	}
+	items := []*yaml.Node{}
+	for i, item := range list.Content {
+		if item.Kind != yaml.ScalarNode || item.Tag != "!!str" {
+			l.errorf(item, fmt.Sprintf("%s[%d]", path, i), "not a string")
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// mapping returns the mapping key of n, which is at path.
+func (l *linter) mapping(n *yaml.Node, path, key string, required bool) *yaml.Node {
+	m := field(n, key)
+	if path != "" {
+		key = path + "." + key
+	}
+	switch {
+	case m == nil && required:
+		l.errorf(n, key, "missing")
+		return nil
+	case m == nil:
+		return nil
+	case m.Kind != yaml.MappingNode:
+		l.errorf(m, key, "not a mapping")
+		return nil
+	}
+
+	return m
+}
+
+func (l *linter) unknownFields(n *yaml.Node, path string, known []string) {
+	for i := 0; i < len(n.Content); i += 2 {
+		key := n.Content[i]
+		if !contains(known, key.Value) {
+			l.errorf(key, path+"."+key.Value, "unknown field%s", suggest(key.Value, known))
+		}
+	}
+}
+
+// field returns the value of the key of the mapping n, if any.
+func field(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// suggest returns a hint with the closest candidate to value, if any is
+// close enough to be a typo.
+func suggest(value string, candidates []string) string {
+	best, distance := "", len(value)/3+1
+	for _, c := range candidates {
+		if d := levenshtein(strings.ToLower(value), strings.ToLower(c)); d < distance {
+			best, distance = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func without(values []string, value string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,265 @@
+package kubewarden
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validPolicy = `apiVersion: policies.kubewarden.io/v1alpha2
+kind: ClusterAdmissionPolicy
+metadata:
+  name: psp-capabilities
+spec:
+  module: registry://ghcr.io/kubewarden/policies/psp-capabilities:v0.1.3
+  rules:
+    - apiGroups: [""]
+      apiVersions: ["v1"]
+      resources: ["pods"]
+      operations: ["CREATE", "UPDATE"]
+  mutating: true
+  settings:
+    allowed_capabilities: ["CHOWN"]
+`
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+`
+
+// writeManifest writes the manifest in a temporary directory, and returns its
+// path.
+func writeManifest(t *testing.T, manifest string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLint(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		manifest string
+
+		// problems are the expected problems, without the file.
+		problems []string
+	}{
+		{
+			name:     "valid",
+			manifest: validPolicy,
+		},
+		{
+			name:     "other documents",
+			manifest: deployment + "---\n" + validPolicy + "---\n",
+		},
+		{
+			name:     "misspelled kind",
+			manifest: strings.Replace(validPolicy, "kind: ClusterAdmissionPolicy", "kind: ClusterAdmisionPolicy", 1),
+			problems: []string{
+				"2:7: error: kind: unsupported kind ClusterAdmisionPolicy, expected one of ClusterAdmissionPolicy, AdmissionPolicy, did you mean ClusterAdmissionPolicy?",
+			},
+		},
+		{
+			name:     "missing kind",
+			manifest: strings.Replace(validPolicy, "kind: ClusterAdmissionPolicy\n", "", 1),
+			problems: []string{
+				"1:1: error: kind: missing, expected one of ClusterAdmissionPolicy, AdmissionPolicy",
+			},
+		},
+		{
+			name:     "unsupported version",
+			manifest: strings.Replace(validPolicy, "v1alpha2", "v1beta1", 1),
+			problems: []string{
+				"1:13: error: apiVersion: unsupported version policies.kubewarden.io/v1beta1, expected one of policies.kubewarden.io/v1, policies.kubewarden.io/v1alpha2",
+			},
+		},
+		{
+			name:     "missing name",
+			manifest: strings.Replace(validPolicy, "  name: psp-capabilities\n", "  labels: {}\n", 1),
+			problems: []string{"4:3: error: metadata.name: missing"},
+		},
+		{
+			name:     "unknown spec field",
+			manifest: strings.Replace(validPolicy, "  mutating: true\n", "  mutating: true\n  polcyServer: default\n", 1),
+			problems: []string{"13:3: error: spec.polcyServer: unknown field, did you mean policyServer?"},
+		},
+		{
+			name:     "namespaceSelector of a namespaced policy",
+			manifest: strings.Replace(strings.Replace(validPolicy, "ClusterAdmissionPolicy", "AdmissionPolicy", 1), "  mutating: true\n", "  mutating: true\n  namespaceSelector: {}\n", 1),
+			problems: []string{"13:3: error: spec.namespaceSelector: unknown field"},
+		},
+		{
+			name:     "module without scheme",
+			manifest: strings.Replace(validPolicy, "registry://", "", 1),
+			problems: []string{`6:11: error: spec.module: "ghcr.io/kubewarden/policies/psp-capabilities:v0.1.3" has no scheme, expected one of registry://, https://, file://`},
+		},
+		{
+			name:     "misspelled module scheme",
+			manifest: strings.Replace(validPolicy, "registry://", "registri://", 1),
+			problems: []string{"6:11: error: spec.module: unsupported scheme registri, expected one of registry, https, file, did you mean registry?"},
+		},
+		{
+			name:     "relative file module",
+			manifest: strings.Replace(validPolicy, "registry://ghcr.io/kubewarden/policies/psp-capabilities:v0.1.3", "file://policy.wasm", 1),
+			problems: []string{`6:11: error: spec.module: file URI "file://policy.wasm" must be absolute, like file:///path/policy.wasm`},
+		},
+		{
+			name:     "missing rules",
+			manifest: strings.Replace(validPolicy, "  rules:\n    - apiGroups: [\"\"]\n      apiVersions: [\"v1\"]\n      resources: [\"pods\"]\n      operations: [\"CREATE\", \"UPDATE\"]\n", "", 1),
+			problems: []string{"6:3: error: spec.rules: missing, the policy would not be evaluated for any request"},
+		},
+		{
+			name:     "misspelled operation",
+			manifest: strings.Replace(validPolicy, `"UPDATE"`, `"UPDTAE"`, 1),
+			problems: []string{"11:30: error: spec.rules[0].operations[1]: UPDTAE is not an operation, expected one of CREATE, UPDATE, DELETE, CONNECT or *, did you mean UPDATE?"},
+		},
+		{
+			name:     "version with group",
+			manifest: strings.Replace(validPolicy, `["v1"]`, `["apps/v1"]`, 1),
+			problems: []string{"9:21: error: spec.rules[0].apiVersions[0]: apps/v1 includes the group, which belongs to apiGroups"},
+		},
+		{
+			name:     "empty resources",
+			manifest: strings.Replace(validPolicy, `["pods"]`, `[]`, 1),
+			problems: []string{"10:18: error: spec.rules[0].resources: empty, the rule would never match"},
+		},
+		{
+			name:     "misspelled resource",
+			manifest: strings.Replace(validPolicy, `["pods"]`, `["pod"]`, 1),
+			problems: []string{`10:19: warning: spec.rules[0].resources[0]: pod is not a resource of the "" API group, did you mean pods?`},
+		},
+		{
+			name:     "unknown group",
+			manifest: strings.Replace(validPolicy, `[""]`, `["app"]`, 1),
+			problems: []string{"8:19: warning: spec.rules[0].apiGroups[0]: app is not a well-known API group, make sure the cluster serves it, did you mean apps?"},
+		},
+		{
+			name:     "mutating not a boolean",
+			manifest: strings.Replace(validPolicy, "mutating: true", `mutating: "yes"`, 1),
+			problems: []string{`12:13: error: spec.mutating: "yes" is not a boolean, it has to be true or false`},
+		},
+		{
+			name:     "failure policy",
+			manifest: validPolicy + "  failurePolicy: Retry\n",
+			problems: []string{`15:18: error: spec.failurePolicy: "Retry" is not Fail nor Ignore`},
+		},
+		{
+			name: "several policies",
+			manifest: strings.Replace(validPolicy, "kind: ClusterAdmissionPolicy", "kind: ClusterAdmisionPolicy", 1) +
+				"---\n" + strings.Replace(validPolicy, "  mutating: true\n", "", 1),
+			problems: []string{
+				"2:7: error: kind: unsupported kind ClusterAdmisionPolicy",
+				"21:3: error: spec.mutating: missing, it has to be true or false",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeManifest(t, tc.manifest)
+			problems, err := Lint(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(problems) != len(tc.problems) {
+				t.Fatalf("expected %d problems, got %v", len(tc.problems), problems)
+			}
+			for i, p := range problems {
+				if expected := path + ":" + tc.problems[i]; !strings.HasPrefix(p.String(), expected) {
+					t.Errorf("expected %q, got %q", expected, p.String())
+				}
+			}
+		})
+	}
+}
+
+func TestLintErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{
+			name:     "no policy",
+			manifest: deployment,
+			err:      "contains no Kubewarden policy",
+		},
+		{
+			name:     "empty",
+			manifest: "",
+			err:      "contains no Kubewarden policy",
+		},
+		{
+			name:     "invalid YAML",
+			manifest: validPolicy + "---\nkind: [\n",
+			err:      "invalid manifest",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Lint(writeManifest(t, tc.manifest))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	problems := []Problem{{}, {Warning: true}, {}}
+	if errs := Errors(problems); errs != 2 {
+		t.Errorf("expected 2 errors, got %d", errs)
+	}
+}
+
+func TestContainsPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		manifest string
+		policy   bool
+		err      string
+	}{
+		{name: "policy", manifest: validPolicy, policy: true},
+		{name: "other resource", manifest: deployment},
+		{name: "empty", manifest: ""},
+		{name: "second document", manifest: deployment + "---\n" + validPolicy, policy: true},
+		{
+			name:     "any kind and version of the group",
+			manifest: "apiVersion: policies.kubewarden.io/v9\nkind: ClusterAdmisionPolicy\n",
+			policy:   true,
+		},
+		{name: "other group", manifest: "apiVersion: policies.example.com/v1\nkind: ClusterAdmissionPolicy\n"},
+		{name: "invalid YAML", manifest: "apiVersion: [\n", err: "invalid manifest"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := ContainsPolicy(writeManifest(t, tc.manifest))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if policy != tc.policy {
+				t.Errorf("expected %t, got %t", tc.policy, policy)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"registry", "https", "file"}
+	for value, expected := range map[string]string{
+		"registri": ", did you mean registry?",
+		"HTTPS":    ", did you mean https?",
+		"oci":      "",
+	} {
+		if got := suggest(value, candidates); got != expected {
+			t.Errorf("suggest(%q): expected %q, got %q", value, expected, got)
+		}
+	}
+}
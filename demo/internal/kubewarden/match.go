@@ -0,0 +1,322 @@
+package kubewarden
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+)
+
+// LabelSelector is a Kubernetes label selector.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// LabelSelectorRequirement is an expression of a label selector.
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// Match is the outcome of matching a policy against a request.
+type Match struct {
+	Policy  *Policy
+	Matched bool
+
+	// Reason explains why the policy matches the request, or the first
+	// reason why it does not.
+	Reason string
+}
+
+// NamespaceLabels returns the labels of a namespace, and whether it is known
+// at all.
+type NamespaceLabels func(namespace string) (map[string]string, bool)
+
+// MatchAll matches every policy against the request, in order.
+func MatchAll(policies []*Policy, r *admission.Request, namespaceLabels NamespaceLabels) []Match {
+	matches := make([]Match, 0, len(policies))
+	for _, p := range policies {
+		matches = append(matches, p.Match(r, namespaceLabels))
+	}
+
+	return matches
+}
+
+// Match decides whether the policy is evaluated for the request, the way the
+// API server does with the webhook configuration of the policy: the request
+// has to match one of the rules, the namespaceSelector and the
+// objectSelector. AdmissionPolicies only apply to their own namespace.
+func (p *Policy) Match(r *admission.Request, namespaceLabels NamespaceLabels) Match {
+	m := Match{Policy: p}
+
+	if p.Kind == AdmissionPolicy && r.Namespace != p.Metadata.Namespace {
+		m.Reason = fmt.Sprintf(
+			"the AdmissionPolicy only applies to namespace %q, the request is for %s",
+			p.Metadata.Namespace, describeNamespace(r.Namespace),
+		)
+		return m
+	}
+
+	rule, reason := p.matchRules(r)
+	if rule < 0 {
+		m.Reason = reason
+		return m
+	}
+
+	if ok, reason := p.matchNamespace(r, namespaceLabels); !ok {
+		m.Reason = reason
+		return m
+	}
+
+	if s := p.Spec.ObjectSelector; s != nil {
+		object, old := objectLabels(r.Object), objectLabels(r.OldObject)
+		if !s.Matches(object) && !s.Matches(old) {
+			m.Reason = fmt.Sprintf(
+				"objectSelector %s does not match the object labels %s", s, formatLabels(object),
+			)
+			return m
+		}
+	}
+
+	selectors := []string{}
+	if s := p.Spec.NamespaceSelector; s != nil {
+		selectors = append(selectors, fmt.Sprintf("namespaceSelector %s", s))
+	}
+	if s := p.Spec.ObjectSelector; s != nil {
+		selectors = append(selectors, fmt.Sprintf("objectSelector %s", s))
+	}
+	if len(selectors) > 0 {
+		reason += ", " + strings.Join(selectors, " and ") + " match"
+	}
+	m.Matched, m.Reason = true, reason
+
+	return m
+}
+
+// matchRules returns the index of the first rule matching the request, or -1
+// and why no rule matches.
+func (p *Policy) matchRules(r *admission.Request) (int, string) {
+	if len(p.Spec.Rules) == 0 {
+		return -1, "the policy has no rules"
+	}
+
+	resource := r.Resource.Resource
+	if r.SubResource != "" {
+		resource += "/" + r.SubResource
+	}
+	reasons := []string{}
+	for i, rule := range p.Spec.Rules {
+		var mismatch string
+		switch {
+		case !matchAny(rule.Operations, r.Operation):
+			mismatch = fmt.Sprintf("operation %s is not one of %s", r.Operation, formatList(rule.Operations))
+		case !matchAny(rule.APIGroups, r.Resource.Group):
+			mismatch = fmt.Sprintf("API group %q is not one of %s", r.Resource.Group, formatList(rule.APIGroups))
+		case !matchAny(rule.APIVersions, r.Resource.Version):
+			mismatch = fmt.Sprintf("API version %s is not one of %s", r.Resource.Version, formatList(rule.APIVersions))
+		case !matchResource(rule.Resources, r.Resource.Resource, r.SubResource):
+			mismatch = fmt.Sprintf("resource %s is not one of %s", resource, formatList(rule.Resources))
+		case !matchScope(rule.Scope, r.Namespace != ""):
+			mismatch = fmt.Sprintf("scope %s does not include %s", rule.Scope, describeNamespace(r.Namespace))
+		default:
+			return i, fmt.Sprintf(
+				"rules[%d] matches %s of %s", i, r.Operation, groupVersionResource(r, resource),
+			)
+		}
+		reasons = append(reasons, fmt.Sprintf("rules[%d]: %s", i, mismatch))
+	}
+
+	return -1, "no rule matches: " + strings.Join(reasons, "; ")
+}
+
+// matchNamespace verifies the namespaceSelector. Requests for cluster wide
+// objects always match it, but for namespaces, which are matched by their
+// own labels.
+func (p *Policy) matchNamespace(r *admission.Request, namespaceLabels NamespaceLabels) (bool, string) {
+	s := p.Spec.NamespaceSelector
+	if s == nil {
+		return true, ""
+	}
+
+	var labels map[string]string
+	switch {
+	case r.Kind.Group == "" && r.Kind.Kind == "Namespace":
+		labels = objectLabels(r.Object)
+		if r.Operation == admission.Delete {
+			labels = objectLabels(r.OldObject)
+		}
+	case r.Namespace == "":
+		return true, ""
+	default:
+		known := false
+		if namespaceLabels != nil {
+			labels, known = namespaceLabels(r.Namespace)
+		}
+		if !known && !s.Matches(labels) {
+			return false, fmt.Sprintf(
+				"namespaceSelector %s does not match namespace %q, whose labels are unknown",
+				s, r.Namespace,
+			)
+		}
+	}
+	if !s.Matches(labels) {
+		return false, fmt.Sprintf(
+			"namespaceSelector %s does not match the namespace labels %s", s, formatLabels(labels),
+		)
+	}
+
+	return true, ""
+}
+
+// Matches returns whether the labels are selected. An empty selector
+// selects everything.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	for k, v := range s.MatchLabels {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	for _, e := range s.MatchExpressions {
+		value, ok := labels[e.Key]
+		switch e.Operator {
+		case "In":
+			if !ok || !contains(e.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if ok && contains(e.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !ok {
+				return false
+			}
+		case "DoesNotExist":
+			if ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *LabelSelector) String() string {
+	requirements := []string{}
+	for _, k := range sortedLabels(s.MatchLabels) {
+		requirements = append(requirements, fmt.Sprintf("%s=%s", k, s.MatchLabels[k]))
+	}
+	for _, e := range s.MatchExpressions {
+		switch e.Operator {
+		case "Exists":
+			requirements = append(requirements, e.Key)
+		case "DoesNotExist":
+			requirements = append(requirements, "!"+e.Key)
+		default:
+			requirements = append(requirements, fmt.Sprintf(
+				"%s %s (%s)", e.Key, strings.ToLower(e.Operator), strings.Join(e.Values, ","),
+			))
+		}
+	}
+	if len(requirements) == 0 {
+		return "{}"
+	}
+
+	return "{" + strings.Join(requirements, ", ") + "}"
+}
+
+func matchAny(values []string, value string) bool {
+	for _, v := range values {
+		if v == "*" || v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchResource matches resources the way webhook rules do: `*` matches all
+// resources but not their subresources, `*/*` matches everything, and
+// `pods/*` or `*/status` match subresources.
+func matchResource(patterns []string, resource, subresource string) bool {
+	for _, p := range patterns {
+		name, sub := p, ""
+		if i := strings.Index(p, "/"); i >= 0 {
+			name, sub = p[:i], p[i+1:]
+		}
+		if (name == "*" || name == resource) && (sub == subresource || (sub == "*" && subresource != "") || p == "*/*") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchScope(scope string, namespaced bool) bool {
+	switch scope {
+	case "Cluster":
+		return !namespaced
+	case "Namespaced":
+		return namespaced
+	}
+
+	return true
+}
+
+func objectLabels(object json.RawMessage) map[string]string {
+	var o struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	json.Unmarshal(object, &o) // nolint: errcheck
+
+	return o.Metadata.Labels
+}
+
+func groupVersionResource(r *admission.Request, resource string) string {
+	if r.Resource.Group == "" {
+		return r.Resource.Version + "/" + resource
+	}
+
+	return r.Resource.Group + "/" + r.Resource.Version + "/" + resource
+}
+
+func describeNamespace(namespace string) string {
+	if namespace == "" {
+		return "a cluster wide object"
+	}
+
+	return fmt.Sprintf("namespace %q", namespace)
+}
+
+func formatList(values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func formatLabels(labels map[string]string) string {
+	s := &LabelSelector{MatchLabels: labels}
+
+	return s.String()
+}
+
+func sortedLabels(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
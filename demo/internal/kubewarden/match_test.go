@@ -0,0 +1,182 @@
+package kubewarden
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+)
+
+func podRequest(operation, namespace, labels string) *admission.Request {
+	return &admission.Request{
+		Kind:      admission.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  admission.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Namespace: namespace,
+		Operation: operation,
+		Object:    json.RawMessage(`{"metadata": {"labels": ` + labels + `}}`),
+	}
+}
+
+func podPolicy(kind string) *Policy {
+	p := &Policy{Kind: kind}
+	p.Metadata.Name, p.Metadata.Namespace = "psp", "default"
+	p.Spec.Rules = []Rule{{
+		APIGroups:   []string{""},
+		APIVersions: []string{"v1"},
+		Resources:   []string{"pods"},
+		Operations:  []string{admission.Create, admission.Update},
+	}}
+
+	return p
+}
+
+func TestMatch(t *testing.T) {
+	namespaces := func(namespace string) (map[string]string, bool) {
+		if namespace == "default" {
+			return map[string]string{"env": "dev"}, true
+		}
+		return nil, false
+	}
+
+	for _, tc := range []struct {
+		name    string
+		policy  func(p *Policy)
+		kind    string
+		request *admission.Request
+		matched bool
+		reason  string
+	}{
+		{
+			name:    "rule",
+			request: podRequest(admission.Create, "default", `{}`),
+			matched: true,
+			reason:  "rules[0] matches CREATE of v1/pods",
+		},
+		{
+			name:    "operation",
+			request: podRequest(admission.Delete, "default", `{}`),
+			reason:  `no rule matches: rules[0]: operation DELETE is not one of ["CREATE", "UPDATE"]`,
+		},
+		{
+			name: "second rule",
+			policy: func(p *Policy) {
+				p.Spec.Rules = append([]Rule{{
+					APIGroups: []string{"apps"}, APIVersions: []string{"*"}, Resources: []string{"*"}, Operations: []string{"*"},
+				}}, p.Spec.Rules...)
+			},
+			request: podRequest(admission.Update, "default", `{}`),
+			matched: true,
+			reason:  "rules[1] matches UPDATE of v1/pods",
+		},
+		{
+			name: "subresource",
+			request: func() *admission.Request {
+				r := podRequest(admission.Create, "default", `{}`)
+				r.SubResource = "exec"
+				return r
+			}(),
+			reason: `no rule matches: rules[0]: resource pods/exec is not one of ["pods"]`,
+		},
+		{
+			name:   "subresources of every resource",
+			policy: func(p *Policy) { p.Spec.Rules[0].Resources = []string{"*/*"} },
+			request: func() *admission.Request {
+				r := podRequest(admission.Create, "default", `{}`)
+				r.SubResource = "exec"
+				return r
+			}(),
+			matched: true,
+			reason:  "rules[0] matches CREATE of v1/pods/exec",
+		},
+		{
+			name:    "scope",
+			policy:  func(p *Policy) { p.Spec.Rules[0].Scope = "Cluster" },
+			request: podRequest(admission.Create, "default", `{}`),
+			reason:  `no rule matches: rules[0]: scope Cluster does not include namespace "default"`,
+		},
+		{
+			name:    "namespace of an AdmissionPolicy",
+			kind:    AdmissionPolicy,
+			request: podRequest(admission.Create, "kube-system", `{}`),
+			reason:  `the AdmissionPolicy only applies to namespace "default", the request is for namespace "kube-system"`,
+		},
+		{
+			name: "namespaceSelector",
+			policy: func(p *Policy) {
+				p.Spec.NamespaceSelector = &LabelSelector{MatchLabels: map[string]string{"env": "dev"}}
+			},
+			request: podRequest(admission.Create, "default", `{}`),
+			matched: true,
+			reason:  "rules[0] matches CREATE of v1/pods, namespaceSelector {env=dev} match",
+		},
+		{
+			name: "namespaceSelector of an unknown namespace",
+			policy: func(p *Policy) {
+				p.Spec.NamespaceSelector = &LabelSelector{MatchLabels: map[string]string{"env": "dev"}}
+			},
+			request: podRequest(admission.Create, "team", `{}`),
+			reason:  `namespaceSelector {env=dev} does not match namespace "team", whose labels are unknown`,
+		},
+		{
+			name: "namespaceSelector of a cluster wide object",
+			policy: func(p *Policy) {
+				p.Spec.NamespaceSelector = &LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+			},
+			request: podRequest(admission.Create, "", `{}`),
+			matched: true,
+		},
+		{
+			name: "objectSelector",
+			policy: func(p *Policy) {
+				p.Spec.ObjectSelector = &LabelSelector{MatchExpressions: []LabelSelectorRequirement{
+					{Key: "app", Operator: "In", Values: []string{"nginx", "apache"}},
+				}}
+			},
+			request: podRequest(admission.Create, "default", `{"app": "redis"}`),
+			reason:  "objectSelector {app in (nginx,apache)} does not match the object labels {app=redis}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kind := tc.kind
+			if kind == "" {
+				kind = ClusterAdmissionPolicy
+			}
+			p := podPolicy(kind)
+			if tc.policy != nil {
+				tc.policy(p)
+			}
+			m := p.Match(tc.request, namespaces)
+			if m.Matched != tc.matched {
+				t.Errorf("expected matched to be %t, got %t: %s", tc.matched, m.Matched, m.Reason)
+			}
+			if !strings.HasPrefix(m.Reason, tc.reason) {
+				t.Errorf("expected the reason %q, got %q", tc.reason, m.Reason)
+			}
+		})
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]string{"app": "nginx", "env": "dev"}
+	for _, tc := range []struct {
+		selector LabelSelector
+		matches  bool
+		str      string
+	}{
+		{LabelSelector{}, true, "{}"},
+		{LabelSelector{MatchLabels: map[string]string{"env": "dev", "app": "nginx"}}, true, "{app=nginx, env=dev}"},
+		{LabelSelector{MatchLabels: map[string]string{"env": "prod"}}, false, "{env=prod}"},
+		{LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "NotIn", Values: []string{"prod"}}}}, true, "{env notin (prod)}"},
+		{LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "Exists"}}}, true, "{app}"},
+		{LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "DoesNotExist"}}}, false, "{!app}"},
+		{LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "Equals"}}}, false, "{app equals ()}"},
+	} {
+		if got := tc.selector.Matches(labels); got != tc.matches {
+			t.Errorf("%s: expected %t, got %t", tc.str, tc.matches, got)
+		}
+		if got := tc.selector.String(); got != tc.str {
+			t.Errorf("expected %q, got %q", tc.str, got)
+		}
+	}
+}
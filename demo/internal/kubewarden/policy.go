@@ -0,0 +1,102 @@
+// Package kubewarden loads the ClusterAdmissionPolicy and AdmissionPolicy
+// manifests of Kubewarden, and evaluates them offline.
+package kubewarden
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+// Kinds of the Kubewarden policy manifests.
+const (
+	ClusterAdmissionPolicy = "ClusterAdmissionPolicy"
+	AdmissionPolicy        = "AdmissionPolicy"
+)
+
+// Policy is a ClusterAdmissionPolicy or AdmissionPolicy manifest.
+type Policy struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace,omitempty"`
+	} `json:"metadata"`
+	Spec Spec `json:"spec"`
+}
+
+// Spec is the spec of a policy.
+type Spec struct {
+	Module            string          `json:"module"`
+	Settings          json.RawMessage `json:"settings,omitempty"`
+	Rules             []Rule          `json:"rules"`
+	Mutating          bool            `json:"mutating"`
+	NamespaceSelector *LabelSelector  `json:"namespaceSelector,omitempty"`
+	ObjectSelector    *LabelSelector  `json:"objectSelector,omitempty"`
+}
+
+// Rule describes the requests a policy is evaluated for.
+type Rule struct {
+	APIGroups   []string `json:"apiGroups"`
+	APIVersions []string `json:"apiVersions"`
+	Resources   []string `json:"resources"`
+	Operations  []string `json:"operations"`
+	Scope       string   `json:"scope,omitempty"`
+}
+
+// Load reads the policy manifest at path.
+func Load(path string) (*Policy, error) {
+	raw, err := admission.ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, errors.Wrapf(err, "invalid policy manifest %s", path)
+	}
+	if !strings.HasPrefix(p.APIVersion, "policies.kubewarden.io/") ||
+		(p.Kind != ClusterAdmissionPolicy && p.Kind != AdmissionPolicy) {
+		return nil, errors.Errorf(
+			"%s is a %s %s, not a Kubewarden policy", path, p.APIVersion, p.Kind,
+		)
+	}
+
+	return p, nil
+}
+
+// Open loads the module of the policy, configured with its settings.
+func (p *Policy) Open(ctx context.Context) (policy.Policy, error) {
+	instance, err := policy.Open(ctx, p.Spec.Module, p.Spec.Settings)
+
+	return instance, errors.Wrapf(err, "unable to load policy %s", p.Metadata.Name)
+}
+
+// Evaluate evaluates the AdmissionRequests, bare or wrapped in
+// AdmissionReviews, at the provided paths with the policy.
+func (p *Policy) Evaluate(ctx context.Context, paths ...string) ([]*policy.ValidationResponse, error) {
+	instance, err := p.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer instance.Close(ctx)
+
+	responses := []*policy.ValidationResponse{}
+	for _, path := range paths {
+		request, err := admission.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		response, err := instance.Validate(ctx, request.Raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to evaluate %s", path)
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
@@ -0,0 +1,167 @@
+package matrix
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+)
+
+// Formats supported by Write.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatCSV      = "csv"
+)
+
+// Write writes the matrix in the provided format.
+func Write(w io.Writer, format string, m *Matrix) error {
+	switch format {
+	case FormatText:
+		return writeText(w, m)
+	case FormatMarkdown:
+		return writeMarkdown(w, m)
+	case FormatCSV:
+		return writeCSV(w, m)
+	}
+
+	return errors.Errorf("unsupported format %q", format)
+}
+
+// String returns the verdict with its message, as a single line.
+func (v Verdict) String() string {
+	switch {
+	case v.Err != nil:
+		return "error: " + v.Err.Error()
+	case v.Allowed:
+		return "accept"
+	case v.Message == "":
+		return "reject"
+	}
+
+	return "reject: " + v.Message
+}
+
+// writeText writes a colored matrix, with the messages as numbered notes
+// below it so the columns stay narrow.
+func writeText(w io.Writer, m *Matrix) error {
+	notes, index := []string{}, map[string]int{}
+	note := func(message string) string {
+		if message == "" {
+			return ""
+		}
+		if _, ok := index[message]; !ok {
+			notes = append(notes, message)
+			index[message] = len(notes)
+		}
+		return fmt.Sprintf(" [%d]", index[message])
+	}
+
+	rows := [][]string{append([]string{"REQUEST"}, m.Policies...)}
+	for i, verdicts := range m.Verdicts {
+		row := []string{m.Requests[i]}
+		for _, v := range verdicts {
+			switch {
+			case v.Err != nil:
+				row = append(row, "error"+note(v.Err.Error()))
+			case v.Allowed:
+				row = append(row, "accept")
+			default:
+				row = append(row, "reject"+note(v.Message))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for j, cell := range row {
+			if len(cell) > widths[j] {
+				widths[j] = len(cell)
+			}
+		}
+	}
+
+	// The cells are colored after the alignment, the escape sequences do
+	// not take any room on the terminal.
+	b := &strings.Builder{}
+	for i, row := range rows {
+		for j, cell := range row {
+			padding := ""
+			if j < len(row)-1 {
+				padding = strings.Repeat(" ", widths[j]-len(cell)+2)
+			}
+			if i > 0 && j > 0 {
+				cell = colorize(cell)
+			}
+			b.WriteString(cell + padding)
+		}
+		b.WriteString("\n")
+	}
+	if len(notes) > 0 {
+		b.WriteString("\n")
+	}
+	for i, n := range notes {
+		fmt.Fprintf(b, "[%d] %s\n", i+1, n)
+	}
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func colorize(cell string) string {
+	for prefix, c := range map[string]color.Color{
+		"accept": color.Green,
+		"reject": color.Red,
+		"error":  color.Yellow,
+	} {
+		if strings.HasPrefix(cell, prefix) {
+			return c.Sprint(prefix) + cell[len(prefix):]
+		}
+	}
+
+	return cell
+}
+
+func writeMarkdown(w io.Writer, m *Matrix) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ").Replace
+
+	b := &strings.Builder{}
+	b.WriteString("| Request |")
+	for _, p := range m.Policies {
+		fmt.Fprintf(b, " %s |", escape(p))
+	}
+	b.WriteString("\n|---|" + strings.Repeat("---|", len(m.Policies)) + "\n")
+	for i, verdicts := range m.Verdicts {
+		fmt.Fprintf(b, "| `%s` |", m.Requests[i])
+		for _, v := range verdicts {
+			fmt.Fprintf(b, " %s |", escape(v.String()))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func writeCSV(w io.Writer, m *Matrix) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(append([]string{"request"}, m.Policies...)); err != nil {
+		return err
+	}
+	for i, verdicts := range m.Verdicts {
+		row := []string{m.Requests[i]}
+		for _, v := range verdicts {
+			row = append(row, v.String())
+		}
+		if err := c.Write(row); err != nil {
+			return err
+		}
+	}
+	c.Flush()
+
+	return c.Error()
+}
@@ -0,0 +1,74 @@
+// Package matrix evaluates every policy against every request fixture, and
+// formats the verdicts as a matrix.
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+// Policy is a column of the matrix: a policy module configured with its
+// settings.
+type Policy struct {
+	Name     string
+	Module   string
+	Settings json.RawMessage
+}
+
+// Verdict is a cell of the matrix.
+type Verdict struct {
+	Allowed bool
+	Message string
+
+	// Err is set when the policy could not evaluate the request.
+	Err error
+}
+
+// Matrix holds the verdict of every policy for every request, indexed by
+// request and then by policy.
+type Matrix struct {
+	Requests []string
+	Policies []string
+	Verdicts [][]Verdict
+}
+
+// Evaluate evaluates every policy against the requests at the provided paths.
+func Evaluate(ctx context.Context, policies []Policy, paths []string) (*Matrix, error) {
+	requests := make([]*admission.Document, 0, len(paths))
+	for _, path := range paths {
+		request, err := admission.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	m := &Matrix{Requests: paths, Verdicts: make([][]Verdict, len(paths))}
+	for i := range m.Verdicts {
+		m.Verdicts[i] = make([]Verdict, len(policies))
+	}
+	for j, p := range policies {
+		m.Policies = append(m.Policies, p.Name)
+		instance, err := policy.Open(ctx, p.Module, p.Settings)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load policy %s", p.Name)
+		}
+		for i, request := range requests {
+			response, err := instance.Validate(ctx, request.Raw)
+			if err != nil {
+				m.Verdicts[i][j].Err = err
+				continue
+			}
+			m.Verdicts[i][j].Allowed = response.Allowed
+			m.Verdicts[i][j].Message = response.Message()
+		}
+		instance.Close(ctx)
+	}
+
+	return m, nil
+}
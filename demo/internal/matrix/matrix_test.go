@@ -0,0 +1,158 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+var requests = []string{
+	"../../test_data/production-ingress.json",
+	"../../test_data/staging-ingress.json",
+}
+
+func TestEvaluate(t *testing.T) {
+	m, err := Evaluate(context.Background(), []Policy{
+		{
+			Name:     "echo accepting",
+			Module:   "../../gatekeeper/policy.wasm",
+			Settings: json.RawMessage(`{"reject": false}`),
+		},
+		{
+			Name:     "echo rejecting",
+			Module:   "file://../../gatekeeper/policy.wasm",
+			Settings: json.RawMessage(`{"reject": true, "rejection_message": "rejected"}`),
+		},
+		{
+			Name:     "letsencrypt-production",
+			Module:   policy.SafeAnnotationsModule + "v0.1.0",
+			Settings: json.RawMessage(`{"constrained_annotations": {"cert-manager.io/cluster-issuer": "letsencrypt-production"}}`),
+		},
+	}, requests)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][]string{
+		{"accept", `reject: echoing a rejection with message: "rejected"`, "accept"},
+		{
+			"accept", `reject: echoing a rejection with message: "rejected"`,
+			"reject: The following annotations are violating user constraints: cert-manager.io/cluster-issuer",
+		},
+	}
+	if len(m.Verdicts) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(m.Verdicts))
+	}
+	for i, row := range expected {
+		for j, verdict := range row {
+			if got := m.Verdicts[i][j].String(); got != verdict {
+				t.Errorf("%s, %s: expected %q, got %q", m.Requests[i], m.Policies[j], verdict, got)
+			}
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policies []Policy
+		requests []string
+		err      string
+	}{
+		{
+			name:     "remote module",
+			policies: []Policy{{Name: "psp", Module: "registry://ghcr.io/kubewarden/policies/psp-capabilities:v0.1.3"}},
+			requests: requests,
+			err:      "unable to load policy psp: policy module registry://ghcr.io/kubewarden/policies/psp-capabilities:v0.1.3 is not available offline",
+		},
+		{
+			name:     "missing request",
+			requests: []string{"../../test_data/missing.json"},
+			err:      "missing.json",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Evaluate(context.Background(), tc.policies, tc.requests)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	color.Disable()
+	m := &Matrix{
+		Requests: []string{"a.json", "b.json"},
+		Policies: []string{"first", "second | third"},
+		Verdicts: [][]Verdict{
+			{{Allowed: true}, {Message: "no, really"}},
+			{{Err: errors.New("boom")}, {Message: "no, really"}},
+		},
+	}
+	for _, tc := range []struct {
+		format string
+		output string
+	}{
+		{
+			format: FormatText,
+			output: "REQUEST  first      second | third\n" +
+				"a.json   accept     reject [1]\n" +
+				"b.json   error [2]  reject [1]\n" +
+				"\n" +
+				"[1] no, really\n" +
+				"[2] boom\n",
+		},
+		{
+			format: FormatMarkdown,
+			output: "| Request | first | second \\| third |\n" +
+				"|---|---|---|\n" +
+				"| `a.json` | accept | reject: no, really |\n" +
+				"| `b.json` | error: boom | reject: no, really |\n",
+		},
+		{
+			format: FormatCSV,
+			output: "request,first,second | third\n" +
+				"a.json,accept,\"reject: no, really\"\n" +
+				"b.json,error: boom,\"reject: no, really\"\n",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			if err := Write(out, tc.format, m); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tc.output {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.output, out)
+			}
+		})
+	}
+
+	if err := Write(&bytes.Buffer{}, "html", m); err == nil || err.Error() != `unsupported format "html"` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestVerdictString(t *testing.T) {
+	for _, tc := range []struct {
+		verdict  Verdict
+		expected string
+	}{
+		{Verdict{Allowed: true}, "accept"},
+		{Verdict{Allowed: true, Message: "ignored"}, "accept"},
+		{Verdict{}, "reject"},
+		{Verdict{Message: "no"}, "reject: no"},
+		{Verdict{Allowed: true, Err: errors.New("boom")}, "error: boom"},
+	} {
+		if got := tc.verdict.String(); got != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package opa
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/compile"
+	"github.com/open-policy-agent/opa/v1/loader"
+	"github.com/pkg/errors"
+)
+
+// The bundle metadata key holding the digest of the sources it was built
+// from.
+const sourceDigestKey = "source_digest"
+
+// BuildOptions specify how a bundle is built.
+type BuildOptions struct {
+	// Entrypoints are the rules exposed by the Wasm module, e.g.
+	// `echo/violation`.
+	Entrypoints []string
+
+	// Paths are the rego files the bundle is built from.
+	Paths []string
+
+	// Output is the path of the resulting bundle.tar.gz.
+	Output string
+
+	// Force rebuilds the bundle even when it is up to date.
+	Force bool
+}
+
+// Build compiles the rego sources into a bundle containing a Wasm module, the
+// same way `opa build -t wasm` does. It returns false when the existing bundle
+// was built from the very same sources and entrypoints, and was therefore
+// kept.
+func Build(ctx context.Context, opts BuildOptions) (bool, error) {
+	if len(opts.Entrypoints) == 0 {
+		return false, errors.New("at least one entrypoint has to be provided")
+	}
+	digest, err := sourceDigest(filepath.Dir(opts.Output), opts.Entrypoints, opts.Paths)
+	if err != nil {
+		return false, err
+	}
+	if !opts.Force && bundleDigest(opts.Output) == digest {
+		return false, nil
+	}
+
+	buf := &bytes.Buffer{}
+	metadata := map[string]interface{}{sourceDigestKey: digest}
+	if err := compile.New().
+		WithTarget(compile.TargetWasm).
+		WithRegoVersion(ast.RegoV0).
+		WithEntrypoints(opts.Entrypoints...).
+		WithPaths(opts.Paths...).
+		WithMetadata(&metadata).
+		WithOutput(buf).
+		Build(ctx); err != nil {
+		return false, compileError(err)
+	}
+
+	return true, errors.Wrap(
+		ioutil.WriteFile(opts.Output, buf.Bytes(), 0o644), "unable to write bundle",
+	)
+}
+
+// ExtractWasm writes the Wasm module contained in the bundle to dest.
+func ExtractWasm(bundle, dest string) error {
+	manifest := struct {
+		Wasm []struct {
+			Module string `json:"module"`
+		} `json:"wasm"`
+	}{}
+	if err := readBundle(bundle, func(name string, r io.Reader) (bool, error) {
+		if name != "/.manifest" {
+			return false, nil
+		}
+		return true, errors.Wrap(
+			json.NewDecoder(r).Decode(&manifest), "unable to decode bundle manifest",
+		)
+	}); err != nil {
+		return err
+	}
+	// Bundles built by older opa versions lack the wasm manifest entry.
+	module := "/policy.wasm"
+	if len(manifest.Wasm) > 0 {
+		module = manifest.Wasm[0].Module
+	}
+
+	found := false
+	if err := readBundle(bundle, func(name string, r io.Reader) (bool, error) {
+		if name != module {
+			return false, nil
+		}
+		found = true
+		wasm, err := ioutil.ReadAll(r)
+		if err != nil {
+			return true, errors.Wrapf(err, "unable to read %s", module)
+		}
+		return true, errors.Wrap(
+			ioutil.WriteFile(dest, wasm, 0o644), "unable to write policy",
+		)
+	}); err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("bundle %s does not contain %s", bundle, module)
+	}
+
+	return nil
+}
+
+// readBundle calls fn for every file of the bundle, until fn returns true.
+func readBundle(bundle string, fn func(name string, r io.Reader) (bool, error)) error {
+	f, err := os.Open(bundle)
+	if err != nil {
+		return errors.Wrap(err, "unable to open bundle")
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read bundle %s", bundle)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to read bundle %s", bundle)
+		}
+		if done, err := fn(path.Join("/", hdr.Name), tr); done || err != nil {
+			return err
+		}
+	}
+}
+
+// sourceDigest returns the digest of the entrypoints and the contents of the
+// sources. The sources are named relative to the root of the bundle, so that
+// the digest does not depend on how their paths are written.
+func sourceDigest(root string, entrypoints, paths []string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to resolve the bundle root")
+	}
+	sources := map[string]string{}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", errors.Wrap(err, "unable to resolve policy source")
+		}
+		name, err := filepath.Rel(root, abs)
+		if err != nil {
+			name = abs
+		}
+		sources[filepath.ToSlash(name)] = abs
+	}
+	names := []string{}
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	sorted := append([]string{}, entrypoints...)
+	sort.Strings(sorted)
+	fmt.Fprintf(h, "%s\n", strings.Join(sorted, ","))
+	for _, name := range names {
+		source, err := ioutil.ReadFile(sources[name])
+		if err != nil {
+			return "", errors.Wrap(err, "unable to read policy source")
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(source))
+		h.Write(source)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// bundleDigest returns the source digest stored in the metadata of an
+// existing bundle, if any.
+func bundleDigest(bundle string) string {
+	manifest := struct {
+		Metadata map[string]interface{} `json:"metadata"`
+	}{}
+	if err := readBundle(bundle, func(name string, r io.Reader) (bool, error) {
+		if name != "/.manifest" {
+			return false, nil
+		}
+		return true, json.NewDecoder(r).Decode(&manifest)
+	}); err != nil {
+		return ""
+	}
+	digest, _ := manifest.Metadata[sourceDigestKey].(string)
+
+	return digest
+}
+
+// compileError reports every compile error on its own line, prefixed by the
+// file and line it refers to.
+func compileError(err error) error {
+	var errs []*ast.Error
+	var astErrs ast.Errors
+	var loadErrs loader.Errors
+	switch {
+	case errors.As(err, &astErrs):
+		errs = astErrs
+	case errors.As(err, &loadErrs):
+		for _, e := range loadErrs {
+			var astErr *ast.Error
+			if !errors.As(e, &astErr) {
+				return errors.Wrap(err, "unable to compile policy")
+			}
+			errs = append(errs, astErr)
+		}
+	default:
+		return errors.Wrap(err, "unable to compile policy")
+	}
+
+	lines := []string{}
+	for _, e := range errs {
+		msg := fmt.Sprintf("%s: %s", e.Code, e.Message)
+		if e.Location != nil {
+			msg = fmt.Sprintf("%s:%d:%d: %s", e.Location.File, e.Location.Row, e.Location.Col, msg)
+		}
+		lines = append(lines, msg)
+	}
+
+	return errors.Errorf(
+		"unable to compile policy: %d error(s) occurred:\n%s",
+		len(errs), strings.Join(lines, "\n"),
+	)
+}
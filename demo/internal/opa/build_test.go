@@ -0,0 +1,84 @@
+package opa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceDigest(t *testing.T) {
+	dir := t.TempDir()
+	for name, source := range map[string]string{
+		"policy.rego":      "package policy\n",
+		"lib/utils.rego":   "package lib\n",
+		"other/utils.rego": "package lib\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	digest := func(root string, entrypoints []string, paths ...string) string {
+		t.Helper()
+		d, err := sourceDigest(root, entrypoints, paths)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return d
+	}
+	entrypoints := []string{"policy/violation", "policy/deny"}
+	expected := digest(".", entrypoints, "policy.rego", "lib/utils.rego")
+
+	for _, tc := range []struct {
+		name        string
+		root        string
+		entrypoints []string
+		paths       []string
+		same        bool
+	}{
+		{"same sources", ".", entrypoints, []string{"policy.rego", "lib/utils.rego"}, true},
+		{"other entrypoint order", ".", []string{"policy/deny", "policy/violation"}, []string{"policy.rego", "lib/utils.rego"}, true},
+		{"other source order", ".", entrypoints, []string{"lib/utils.rego", "policy.rego"}, true},
+		{"other spelling", "./", entrypoints, []string{"./policy.rego", "lib/../lib/utils.rego"}, true},
+		{"absolute paths", dir, entrypoints, []string{filepath.Join(dir, "policy.rego"), filepath.Join(dir, "lib/utils.rego")}, true},
+		{"duplicates", ".", entrypoints, []string{"policy.rego", "lib/utils.rego", "./policy.rego"}, true},
+		{"renamed source", ".", entrypoints, []string{"policy.rego", "other/utils.rego"}, false},
+		{"missing source", ".", entrypoints, []string{"policy.rego"}, false},
+		{"other entrypoints", ".", []string{"policy/deny"}, []string{"policy.rego", "lib/utils.rego"}, false},
+		{"other root", "lib", entrypoints, []string{"policy.rego", "lib/utils.rego"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if same := digest(tc.root, tc.entrypoints, tc.paths...) == expected; same != tc.same {
+				t.Errorf("expected the digest to be the same: %t, got %t", tc.same, same)
+			}
+		})
+	}
+
+	if err := os.WriteFile("policy.rego", []byte("package changed\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if digest(".", entrypoints, "policy.rego", "lib/utils.rego") == expected {
+		t.Error("expected the digest to change with the contents of the sources")
+	}
+	if _, err := sourceDigest(".", entrypoints, []string{"missing.rego"}); err == nil {
+		t.Error("expected an error for a missing source")
+	}
+}
+
+// TestBundleIsUpToDate verifies that the committed gatekeeper bundle was
+// built out of the committed sources, so that the demo skips the build.
+func TestBundleIsUpToDate(t *testing.T) {
+	const root = "../../gatekeeper"
+	digest, err := sourceDigest(root, []string{"echo/violation"}, []string{filepath.Join(root, "echo.rego")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if committed := bundleDigest(filepath.Join(root, "bundle.tar.gz")); committed != digest {
+		t.Errorf("the bundle was built out of other sources: its digest is %q, the sources are %q", committed, digest)
+	}
+}
@@ -0,0 +1,69 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// builtinFuncs are the OPA builtins not implemented within the Wasm module
+// itself that are supported by this host.
+var builtinFuncs = map[string]func(m *Module, args ...interface{}) (interface{}, error){
+	"sprintf": sprintf,
+	"trace":   trace,
+}
+
+func sprintf(_ *Module, args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.Errorf("expected 2 arguments, got %d", len(args))
+	}
+	format, ok := args[0].(string)
+	if !ok {
+		return nil, errors.New("format must be a string")
+	}
+	values, ok := args[1].([]interface{})
+	if !ok {
+		return nil, errors.New("values must be an array")
+	}
+
+	fmtArgs := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string, bool:
+			fmtArgs = append(fmtArgs, v)
+		case json.Number:
+			if i, ok := new(big.Int).SetString(v.String(), 10); ok {
+				fmtArgs = append(fmtArgs, i)
+			} else if f, err := v.Float64(); err == nil {
+				fmtArgs = append(fmtArgs, f)
+			} else {
+				fmtArgs = append(fmtArgs, v.String())
+			}
+		default:
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			fmtArgs = append(fmtArgs, string(raw))
+		}
+	}
+
+	return fmt.Sprintf(format, fmtArgs...), nil
+}
+
+func trace(m *Module, args ...interface{}) (interface{}, error) {
+	notes := []string{}
+	for _, arg := range args {
+		note, ok := arg.(string)
+		if !ok {
+			return nil, errors.New("note must be a string")
+		}
+		notes = append(notes, note)
+	}
+	m.traces = append(m.traces, strings.Join(notes, " "))
+
+	return true, nil
+}
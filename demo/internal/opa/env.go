@@ -0,0 +1,77 @@
+package opa
+
+// envBinary returns a Wasm module that defines the memory imported by the
+// policy, with the given amount of initial pages, and re-exports the host
+// functions from hostModule as the policy expects them.
+func envBinary(minPages uint32) []byte {
+	const (
+		i32      = 0x7f
+		funcType = 0x60
+		kindFunc = 0x00
+		kindMem  = 0x02
+	)
+
+	funcs := []string{"opa_abort"}
+	for arity := 0; arity <= 4; arity++ {
+		funcs = append(funcs, builtinName(arity))
+	}
+
+	types := leb(uint32(len(funcs)))
+	// opa_abort(addr)
+	types = append(types, funcType, 1, i32, 0)
+	// opa_builtinN(id, ctx, args...) -> addr
+	for arity := 0; arity <= 4; arity++ {
+		types = append(types, funcType, byte(arity+2))
+		for i := 0; i < arity+2; i++ {
+			types = append(types, i32)
+		}
+		types = append(types, 1, i32)
+	}
+
+	imports := leb(uint32(len(funcs)))
+	for i, name := range funcs {
+		imports = append(imports, str(hostModule)...)
+		imports = append(imports, str(name)...)
+		imports = append(imports, kindFunc)
+		imports = append(imports, leb(uint32(i))...)
+	}
+
+	memory := append([]byte{1, 0x00}, leb(minPages)...)
+
+	exports := leb(uint32(len(funcs) + 1))
+	for i, name := range funcs {
+		exports = append(exports, str(name)...)
+		exports = append(exports, kindFunc)
+		exports = append(exports, leb(uint32(i))...)
+	}
+	exports = append(exports, str("memory")...)
+	exports = append(exports, kindMem, 0)
+
+	binary := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	for _, s := range []struct {
+		id      byte
+		content []byte
+	}{{1, types}, {2, imports}, {5, memory}, {7, exports}} {
+		binary = append(binary, s.id)
+		binary = append(binary, leb(uint32(len(s.content)))...)
+		binary = append(binary, s.content...)
+	}
+
+	return binary
+}
+
+func str(s string) []byte {
+	return append(leb(uint32(len(s))), s...)
+}
+
+func leb(v uint32) []byte {
+	out := []byte{}
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
@@ -0,0 +1,350 @@
+// Package opa builds rego policies into WebAssembly and evaluates them, the
+// way `opa build -t wasm` and OPA do, without the need of any external tool.
+//
+// The Wasm module is executed with wazero, a pure Go WebAssembly runtime, and
+// the host side of the OPA Wasm ABI is implemented here.
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// The policy imports its memory and the builtin functions from this module.
+const envModule = "env"
+
+// Host functions are provided by this module, and re-exported by a tiny Wasm
+// module named envModule, given that wazero host modules cannot export
+// memories.
+const hostModule = "opa"
+
+// Module is an instantiated OPA Wasm policy. It is safe for concurrent use.
+type Module struct {
+	sync.Mutex
+	runtime     wazero.Runtime
+	policy      api.Module
+	heapPtr     uint32
+	dataAddr    uint32
+	entrypoints map[string]int32
+	builtins    map[int32]string
+	traces      []string
+}
+
+// Result is the outcome of an evaluation.
+type Result struct {
+	// Value contains the value of the entrypoint, as it is returned by
+	// OPA: a list of objects with a `result` key.
+	Value json.RawMessage
+
+	// Traces contains the notes emitted with the `trace` builtin.
+	Traces []string
+}
+
+// New compiles and instantiates the provided Wasm policy.
+func New(ctx context.Context, wasm []byte) (*Module, error) {
+	m := &Module{
+		runtime:     wazero.NewRuntime(ctx),
+		entrypoints: map[string]int32{},
+		builtins:    map[int32]string{},
+	}
+	if err := m.instantiate(ctx, wasm); err != nil {
+		m.runtime.Close(ctx)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Module) instantiate(ctx context.Context, wasm []byte) error {
+	compiled, err := m.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return errors.Wrap(err, "unable to compile policy")
+	}
+	memories := compiled.ImportedMemories()
+	if len(memories) != 1 {
+		return errors.Errorf("policy imports %d memories, expected 1", len(memories))
+	}
+
+	builder := m.runtime.NewHostModuleBuilder(hostModule)
+	builder.NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(m.abort), []api.ValueType{api.ValueTypeI32}, nil).
+		Export("opa_abort")
+	for arity := 0; arity <= 4; arity++ {
+		builder.NewFunctionBuilder().
+			WithGoModuleFunction(m.builtin(arity), i32s(arity+2), i32s(1)).
+			Export(builtinName(arity))
+	}
+	if _, err := builder.Instantiate(ctx); err != nil {
+		return errors.Wrap(err, "unable to instantiate host functions")
+	}
+	if _, err := m.runtime.InstantiateWithConfig(
+		ctx, envBinary(memories[0].Min()), wazero.NewModuleConfig().WithName(envModule),
+	); err != nil {
+		return errors.Wrap(err, "unable to instantiate policy environment")
+	}
+
+	m.policy, err = m.runtime.InstantiateModule(
+		ctx, compiled, wazero.NewModuleConfig().WithName("policy"),
+	)
+	if err != nil {
+		return errors.Wrap(err, "unable to instantiate policy")
+	}
+
+	if err := m.load(ctx, "entrypoints", &m.entrypoints); err != nil {
+		return err
+	}
+	builtins := map[string]int32{}
+	if err := m.load(ctx, "builtins", &builtins); err != nil {
+		return err
+	}
+	for name, id := range builtins {
+		if _, ok := builtinFuncs[name]; !ok {
+			return errors.Errorf("policy requires unsupported builtin %q", name)
+		}
+		m.builtins[id] = name
+	}
+
+	if m.dataAddr, err = m.parse(ctx, []byte("{}")); err != nil {
+		return err
+	}
+	m.heapPtr, err = m.call32(ctx, "opa_heap_ptr_get")
+
+	return err
+}
+
+// load stores the JSON value returned by the exported function fn into v.
+func (m *Module) load(ctx context.Context, fn string, v interface{}) error {
+	addr, err := m.call32(ctx, fn)
+	if err != nil {
+		return err
+	}
+	raw, err := m.dump(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(json.Unmarshal(raw, v), "unable to decode %s", fn)
+}
+
+// Close releases all resources held by the module.
+func (m *Module) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
+
+// Entrypoints returns the names of the entrypoints the policy was built with.
+func (m *Module) Entrypoints() []string {
+	names := []string{}
+	for name := range m.entrypoints {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Eval evaluates the given entrypoint with the provided JSON input. An empty
+// entrypoint is allowed when the policy has exactly one.
+func (m *Module) Eval(ctx context.Context, entrypoint string, input []byte) (*Result, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	id, err := m.entrypoint(entrypoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every evaluation starts from a clean heap, the data document is
+	// allocated before it and is preserved.
+	if _, err := m.call(ctx, "opa_heap_ptr_set", uint64(m.heapPtr)); err != nil {
+		return nil, err
+	}
+	m.traces = nil
+
+	inputAddr, err := m.parse(ctx, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid input")
+	}
+	evalCtx, err := m.call32(ctx, "opa_eval_ctx_new")
+	if err != nil {
+		return nil, err
+	}
+	for fn, arg := range map[string]uint32{
+		"opa_eval_ctx_set_input":      inputAddr,
+		"opa_eval_ctx_set_data":       m.dataAddr,
+		"opa_eval_ctx_set_entrypoint": uint32(id),
+	} {
+		if _, err := m.call(ctx, fn, uint64(evalCtx), uint64(arg)); err != nil {
+			return nil, err
+		}
+	}
+	code, err := m.call32(ctx, "eval", evalCtx)
+	if err != nil {
+		return nil, errors.Wrap(err, "evaluation failed")
+	}
+	if code != 0 {
+		return nil, errors.Errorf("evaluation failed with code %d", code)
+	}
+	resultAddr, err := m.call32(ctx, "opa_eval_ctx_get_result", evalCtx)
+	if err != nil {
+		return nil, err
+	}
+	value, err := m.dump(ctx, resultAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Value: value, Traces: m.traces}, nil
+}
+
+func (m *Module) entrypoint(name string) (int32, error) {
+	if name == "" {
+		if len(m.entrypoints) != 1 {
+			return 0, errors.Errorf(
+				"policy has %d entrypoints, one has to be selected", len(m.entrypoints),
+			)
+		}
+		for _, id := range m.entrypoints {
+			return id, nil
+		}
+	}
+	id, ok := m.entrypoints[name]
+	if !ok {
+		return 0, errors.Errorf("unknown entrypoint %q", name)
+	}
+
+	return id, nil
+}
+
+func (m *Module) call(ctx context.Context, fn string, args ...uint64) ([]uint64, error) {
+	f := m.policy.ExportedFunction(fn)
+	if f == nil {
+		return nil, errors.Errorf("policy does not export %s", fn)
+	}
+	res, err := f.Call(ctx, args...)
+
+	return res, errors.Wrapf(err, "call to %s failed", fn)
+}
+
+func (m *Module) call32(ctx context.Context, fn string, args ...uint32) (uint32, error) {
+	args64 := make([]uint64, 0, len(args))
+	for _, a := range args {
+		args64 = append(args64, uint64(a))
+	}
+	res, err := m.call(ctx, fn, args64...)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 1 {
+		return 0, errors.Errorf("%s returned %d values, expected 1", fn, len(res))
+	}
+
+	return uint32(res[0]), nil
+}
+
+// parse copies the provided JSON document into the policy memory and returns
+// the address of the parsed value.
+func (m *Module) parse(ctx context.Context, doc []byte) (uint32, error) {
+	addr, err := m.call32(ctx, "opa_malloc", uint32(len(doc)))
+	if err != nil {
+		return 0, err
+	}
+	if !m.policy.Memory().Write(addr, doc) {
+		return 0, errors.New("unable to write into policy memory")
+	}
+	value, err := m.call32(ctx, "opa_json_parse", addr, uint32(len(doc)))
+	if err != nil {
+		return 0, err
+	}
+	if value == 0 {
+		return 0, errors.New("unable to parse JSON document")
+	}
+
+	return value, nil
+}
+
+// dump serializes the value at the provided address as JSON.
+func (m *Module) dump(ctx context.Context, addr uint32) ([]byte, error) {
+	str, err := m.call32(ctx, "opa_json_dump", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.cstring(str)
+}
+
+func (m *Module) cstring(addr uint32) ([]byte, error) {
+	mem := m.policy.Memory()
+	buf, ok := mem.Read(addr, mem.Size()-addr)
+	if !ok {
+		return nil, errors.Errorf("address %d out of policy memory", addr)
+	}
+	end := bytes.IndexByte(buf, 0)
+	if end < 0 {
+		return nil, errors.Errorf("unterminated string at address %d", addr)
+	}
+
+	return append([]byte(nil), buf[:end]...), nil
+}
+
+func (m *Module) abort(ctx context.Context, _ api.Module, stack []uint64) {
+	msg, err := m.cstring(uint32(stack[0]))
+	if err != nil {
+		panic(errors.Wrap(err, "policy aborted"))
+	}
+	panic(errors.Errorf("policy aborted: %s", msg))
+}
+
+func (m *Module) builtin(arity int) api.GoModuleFunc {
+	return func(ctx context.Context, _ api.Module, stack []uint64) {
+		id := int32(stack[0])
+		name, ok := m.builtins[id]
+		if !ok {
+			panic(errors.Errorf("unknown builtin %d", id))
+		}
+		args := make([]interface{}, 0, arity)
+		for _, addr := range stack[2 : 2+arity] {
+			raw, err := m.dump(ctx, uint32(addr))
+			if err != nil {
+				panic(err)
+			}
+			var arg interface{}
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			if err := dec.Decode(&arg); err != nil {
+				panic(errors.Wrapf(err, "unable to decode %s argument", name))
+			}
+			args = append(args, arg)
+		}
+		res, err := builtinFuncs[name](m, args...)
+		if err != nil {
+			panic(errors.Wrapf(err, "%s failed", name))
+		}
+		raw, err := json.Marshal(res)
+		if err != nil {
+			panic(errors.Wrapf(err, "unable to encode %s result", name))
+		}
+		addr, err := m.parse(ctx, raw)
+		if err != nil {
+			panic(err)
+		}
+		stack[0] = uint64(addr)
+	}
+}
+
+func builtinName(arity int) string {
+	return "opa_builtin" + string(rune('0'+arity))
+}
+
+func i32s(n int) []api.ValueType {
+	types := make([]api.ValueType, n)
+	for i := range types {
+		types[i] = api.ValueTypeI32
+	}
+
+	return types
+}
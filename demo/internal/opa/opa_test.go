@@ -0,0 +1,173 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadEcho instantiates the gatekeeper echo policy of the demo.
+func loadEcho(t *testing.T) *Module {
+	t.Helper()
+	wasm, err := os.ReadFile("../../gatekeeper/policy.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(context.Background(), wasm)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { m.Close(context.Background()) })
+
+	return m
+}
+
+func TestEval(t *testing.T) {
+	m := loadEcho(t)
+	if entrypoints := m.Entrypoints(); !reflect.DeepEqual(entrypoints, []string{"echo/violation"}) {
+		t.Fatalf("unexpected entrypoints %v", entrypoints)
+	}
+
+	requests, err := filepath.Glob("../../test_data/*.json")
+	if err != nil || len(requests) == 0 {
+		t.Fatalf("no requests found: %v", err)
+	}
+	for _, request := range requests {
+		review, err := os.ReadFile(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			name       string
+			parameters string
+			result     string
+			traces     []string
+		}{
+			{
+				name:       "accept",
+				parameters: `{"reject": false}`,
+				result:     `[{"result":[]}]`,
+			},
+			{
+				name:       "reject",
+				parameters: `{"reject": true, "rejection_message": "rejected by \"echo\""}`,
+				result:     `[{"result":[{"msg":"echoing a rejection with message: \"rejected by \\\"echo\\\"\""}]}]`,
+				traces:     []string{"this is a trace message coming from within the policy"},
+			},
+		} {
+			t.Run(filepath.Base(request)+"/"+tc.name, func(t *testing.T) {
+				input := `{"parameters": ` + tc.parameters + `, "review": ` + string(review) + `}`
+				// The entrypoint can be omitted, the policy has only one.
+				res, err := m.Eval(context.Background(), "", []byte(input))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(res.Value) != tc.result {
+					t.Errorf("expected %s, got %s", tc.result, res.Value)
+				}
+				if !reflect.DeepEqual(res.Traces, tc.traces) {
+					t.Errorf("expected the traces %q, got %q", tc.traces, res.Traces)
+				}
+			})
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	m := loadEcho(t)
+	for _, tc := range []struct {
+		name       string
+		entrypoint string
+		input      string
+		err        string
+	}{
+		{"unknown entrypoint", "echo/deny", `{}`, `unknown entrypoint "echo/deny"`},
+		{"invalid input", "echo/violation", `{"parameters":`, "invalid input"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := m.Eval(context.Background(), tc.entrypoint, []byte(tc.input))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+
+	// The module is still usable after a failed evaluation.
+	if _, err := m.Eval(context.Background(), "echo/violation", []byte(`{}`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(context.Background(), []byte("not wasm")); err == nil {
+		t.Error("expected an error for an invalid module")
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		format string
+		values []interface{}
+		result string
+		err    bool
+	}{
+		{"string", "%s and %q", []interface{}{"a", "b"}, `a and "b"`, false},
+		{"integer", "%d", []interface{}{json.Number("42")}, "42", false},
+		{"big integer", "%d", []interface{}{json.Number("123456789012345678901234567890")}, "123456789012345678901234567890", false},
+		{"float", "%.2f", []interface{}{json.Number("1.5")}, "1.50", false},
+		{"boolean", "%t", []interface{}{true}, "true", false},
+		{"composite", "%s", []interface{}{map[string]interface{}{"a": []interface{}{"b"}}}, `{"a":["b"]}`, false},
+		{"not an array", "%s", nil, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var values interface{} = tc.values
+			if tc.values == nil {
+				values = "value"
+			}
+			res, err := sprintf(nil, tc.format, values)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res != tc.result {
+				t.Errorf("expected %q, got %q", tc.result, res)
+			}
+		})
+	}
+
+	if _, err := sprintf(nil, "%s"); err == nil {
+		t.Error("expected an error for a missing argument")
+	}
+	if _, err := sprintf(nil, 1, []interface{}{}); err == nil {
+		t.Error("expected an error for a format that is not a string")
+	}
+	// Integers are formatted exactly, not through a float.
+	if res, _ := sprintf(nil, "%v", []interface{}{json.Number("9007199254740993")}); res != "9007199254740993" {
+		t.Errorf("unexpected integer %v", res)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	m := &Module{}
+	for _, note := range []string{"first", "second"} {
+		if res, err := trace(m, note); err != nil || res != true {
+			t.Fatalf("unexpected result %v, %v", res, err)
+		}
+	}
+	if expected := []string{"first", "second"}; !reflect.DeepEqual(m.traces, expected) {
+		t.Errorf("expected %q, got %q", expected, m.traces)
+	}
+	if _, err := trace(m, 1); err == nil {
+		t.Error("expected an error for a note that is not a string")
+	}
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/opa"
+)
+
+// Gatekeeper evaluates a Gatekeeper policy compiled to Wasm, the same way
+// `kwctl run -e gatekeeper` does.
+type Gatekeeper struct {
+	module     *opa.Module
+	entrypoint string
+}
+
+// LoadGatekeeper loads the Gatekeeper Wasm policy at path.
+func LoadGatekeeper(ctx context.Context, path string) (*Gatekeeper, error) {
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read policy")
+	}
+	module, err := opa.New(ctx, wasm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load policy %s", path)
+	}
+
+	return &Gatekeeper{module: module}, nil
+}
+
+// SetEntrypoint selects the entrypoint to be evaluated. It is only required
+// when the policy was built with more than one.
+func (g *Gatekeeper) SetEntrypoint(entrypoint string) {
+	g.entrypoint = entrypoint
+}
+
+// Close releases the resources of the policy.
+func (g *Gatekeeper) Close(ctx context.Context) error {
+	return g.module.Close(ctx)
+}
+
+// Validate evaluates the AdmissionRequest, bare or wrapped in an
+// AdmissionReview, with the provided settings. The traces emitted by the
+// policy are returned along with the response.
+func (g *Gatekeeper) Validate(
+	ctx context.Context, request, settings json.RawMessage,
+) (*ValidationResponse, []string, error) {
+	d, err := admission.Parse(request)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid request")
+	}
+	if len(settings) == 0 {
+		settings = json.RawMessage("{}")
+	}
+	input, err := json.Marshal(map[string]json.RawMessage{
+		"parameters": settings,
+		"review":     d.Raw,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to build policy input")
+	}
+
+	result, err := g.module.Eval(ctx, g.entrypoint, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var values []struct {
+		Result []struct {
+			Msg string `json:"msg"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(result.Value, &values); err != nil {
+		return nil, nil, errors.Wrap(err, "unexpected policy result")
+	}
+
+	uid := d.Request.UID
+	violations := []string{}
+	for _, v := range values {
+		for _, violation := range v.Result {
+			violations = append(violations, violation.Msg)
+		}
+	}
+	if len(violations) == 0 {
+		return Accept(uid), result.Traces, nil
+	}
+
+	return Reject(uid, strings.Join(violations, ", ")), result.Traces, nil
+}
@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SafeAnnotationsModule is the prefix of the safe-annotations policy modules,
+// evaluated natively whatever their version.
+const SafeAnnotationsModule = "registry://ghcr.io/kubewarden/policies/safe-annotations:"
+
+// Policy is a policy configured with its settings.
+type Policy interface {
+	// Validate evaluates the provided AdmissionRequest.
+	Validate(ctx context.Context, request json.RawMessage) (*ValidationResponse, error)
+
+	// Close releases the resources of the policy.
+	Close(ctx context.Context) error
+}
+
+// Open loads the policy referenced by module, as it is written in the spec of
+// a ClusterAdmissionPolicy, and configures it with settings. The
+// safe-annotations policy is available from the registry, while Gatekeeper
+// Wasm policies are loaded from `file://` URIs or plain paths.
+func Open(ctx context.Context, module string, settings json.RawMessage) (Policy, error) {
+	switch {
+	case strings.HasPrefix(module, SafeAnnotationsModule):
+		p, err := NewSafeAnnotations(settings)
+		if err != nil {
+			return nil, err
+		}
+		return safeAnnotationsPolicy{p}, nil
+	case strings.Contains(module, "://") && !strings.HasPrefix(module, "file://"):
+		return nil, errors.Errorf("policy module %s is not available offline", module)
+	}
+
+	g, err := LoadGatekeeper(ctx, strings.TrimPrefix(module, "file://"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &gatekeeperPolicy{Gatekeeper: g, settings: settings}, nil
+}
+
+type safeAnnotationsPolicy struct {
+	*SafeAnnotations
+}
+
+func (p safeAnnotationsPolicy) Validate(
+	_ context.Context, request json.RawMessage,
+) (*ValidationResponse, error) {
+	return p.SafeAnnotations.Validate(request)
+}
+
+func (safeAnnotationsPolicy) Close(context.Context) error {
+	return nil
+}
+
+type gatekeeperPolicy struct {
+	*Gatekeeper
+	settings json.RawMessage
+}
+
+func (p *gatekeeperPolicy) Validate(
+	ctx context.Context, request json.RawMessage,
+) (*ValidationResponse, error) {
+	response, _, err := p.Gatekeeper.Validate(ctx, request, p.settings)
+
+	return response, err
+}
+
+// SettingsKeys returns the settings accepted by the module, when they are
+// known.
+func SettingsKeys(module string) ([]string, bool) {
+	if !strings.HasPrefix(module, SafeAnnotationsModule) {
+		return nil, false
+	}
+	keys := []string{}
+	t := reflect.TypeOf(SafeAnnotationsSettings{})
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+
+	return keys, true
+}
+
+// ValidateSettings verifies the settings of the module, when the module is
+// available offline.
+func ValidateSettings(module string, settings json.RawMessage) error {
+	if !strings.HasPrefix(module, SafeAnnotationsModule) {
+		return nil
+	}
+	_, err := NewSafeAnnotations(settings)
+
+	return err
+}
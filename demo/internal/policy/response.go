@@ -0,0 +1,42 @@
+// Package policy evaluates Kubewarden policies offline and produces the same
+// responses kwctl prints.
+package policy
+
+// ValidationResponse is the verdict of a policy for a given request, as it is
+// printed by `kwctl run`.
+type ValidationResponse struct {
+	UID       string                    `json:"uid"`
+	Allowed   bool                      `json:"allowed"`
+	PatchType string                    `json:"patchType,omitempty"`
+	Patch     string                    `json:"patch,omitempty"`
+	Status    *ValidationResponseStatus `json:"status,omitempty"`
+}
+
+// ValidationResponseStatus contains the details of a rejection.
+type ValidationResponseStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+// Accept creates a response accepting the request with the provided uid.
+func Accept(uid string) *ValidationResponse {
+	return &ValidationResponse{UID: uid, Allowed: true}
+}
+
+// Reject creates a response rejecting the request with the provided uid.
+func Reject(uid, message string) *ValidationResponse {
+	return &ValidationResponse{
+		UID:     uid,
+		Allowed: false,
+		Status:  &ValidationResponseStatus{Message: message},
+	}
+}
+
+// Message returns the rejection message of the response, if any.
+func (r *ValidationResponse) Message() string {
+	if r.Status == nil {
+		return ""
+	}
+
+	return r.Status.Message
+}
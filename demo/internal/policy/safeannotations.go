@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+)
+
+// SafeAnnotations is a native implementation of the
+// ghcr.io/kubewarden/policies/safe-annotations policy.
+type SafeAnnotations struct {
+	denied      []string
+	mandatory   []string
+	constrained map[string]*regexp.Regexp
+}
+
+// SafeAnnotationsSettings are the settings accepted by the safe-annotations
+// policy.
+type SafeAnnotationsSettings struct {
+	DeniedAnnotations      []string          `json:"denied_annotations,omitempty"`
+	MandatoryAnnotations   []string          `json:"mandatory_annotations,omitempty"`
+	ConstrainedAnnotations map[string]string `json:"constrained_annotations,omitempty"`
+}
+
+// NewSafeAnnotations validates the provided settings and creates a new
+// safe-annotations policy out of them.
+func NewSafeAnnotations(settings json.RawMessage) (*SafeAnnotations, error) {
+	s := SafeAnnotationsSettings{}
+	if len(settings) > 0 {
+		dec := json.NewDecoder(strings.NewReader(string(settings)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&s); err != nil {
+			return nil, errors.Wrap(err, "invalid safe-annotations settings")
+		}
+	}
+
+	p := &SafeAnnotations{
+		denied:      s.DeniedAnnotations,
+		mandatory:   s.MandatoryAnnotations,
+		constrained: map[string]*regexp.Regexp{},
+	}
+	for annotation, expr := range s.ConstrainedAnnotations {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "invalid constraint for annotation %s", annotation,
+			)
+		}
+		p.constrained[annotation] = re
+	}
+	for _, annotation := range p.denied {
+		for _, m := range p.mandatory {
+			if annotation == m {
+				return nil, errors.Errorf(
+					"annotation %s cannot be both denied and mandatory", annotation,
+				)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Validate evaluates the provided AdmissionRequest, bare or wrapped in an
+// AdmissionReview.
+func (p *SafeAnnotations) Validate(request json.RawMessage) (*ValidationResponse, error) {
+	d, err := admission.Parse(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid request")
+	}
+	var object struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if len(d.Request.Object) > 0 {
+		if err := json.Unmarshal(d.Request.Object, &object); err != nil {
+			return nil, errors.Wrap(err, "invalid object")
+		}
+	}
+	annotations := object.Metadata.Annotations
+
+	denied := []string{}
+	for _, a := range p.denied {
+		if _, ok := annotations[a]; ok {
+			denied = append(denied, a)
+		}
+	}
+	missing := []string{}
+	for _, a := range p.mandatory {
+		if _, ok := annotations[a]; !ok {
+			missing = append(missing, a)
+		}
+	}
+	violating := []string{}
+	for a, re := range p.constrained {
+		if value, ok := annotations[a]; ok && !re.MatchString(value) {
+			violating = append(violating, a)
+		}
+	}
+	sort.Strings(violating)
+
+	errs := []string{}
+	if len(denied) > 0 {
+		errs = append(errs, "The following annotations are denied: "+
+			strings.Join(denied, ","))
+	}
+	if len(missing) > 0 {
+		errs = append(errs, "The following mandatory annotations are missing: "+
+			strings.Join(missing, ","))
+	}
+	if len(violating) > 0 {
+		errs = append(errs, "The following annotations are violating user constraints: "+
+			strings.Join(violating, ","))
+	}
+	if len(errs) > 0 {
+		return Reject(d.Request.UID, strings.Join(errs, ", ")), nil
+	}
+
+	return Accept(d.Request.UID), nil
+}
@@ -0,0 +1,132 @@
+package policytest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Formats supported by Report.
+const (
+	FormatTAP   = "tap"
+	FormatJUnit = "junit"
+)
+
+// Report writes the results of the suites in the provided format.
+func Report(w io.Writer, format string, suites []*Suite, results [][]*Result) error {
+	switch format {
+	case FormatTAP:
+		return reportTAP(w, results)
+	case FormatJUnit:
+		return reportJUnit(w, suites, results)
+	}
+
+	return errors.Errorf("unsupported format %q", format)
+}
+
+// reportTAP writes the results as a TAP version 13 stream.
+func reportTAP(w io.Writer, results [][]*Result) error {
+	all := []*Result{}
+	for _, r := range results {
+		all = append(all, r...)
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "TAP version 13\n1..%d\n", len(all))
+	for i, r := range all {
+		status := "ok"
+		if !r.Passed() {
+			status = "not ok"
+		}
+		fmt.Fprintf(b, "%s %d - %s: %s\n", status, i+1, r.Policy, r.Test)
+		if r.Passed() {
+			continue
+		}
+		detail := r.Failure
+		if r.Err != nil {
+			detail = r.Err.Error()
+		}
+		fmt.Fprintf(b, "  ---\n  message: %q\n  ...\n", detail)
+	}
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// reportJUnit writes the results as a JUnit XML report, with a test suite for
+// every suite.
+func reportJUnit(w io.Writer, suites []*Suite, results [][]*Result) error {
+	report := junitTestSuites{}
+	for i, s := range suites {
+		suite := junitTestSuite{Name: s.Name}
+		var seconds float64
+		for _, r := range results[i] {
+			c := junitTestCase{
+				Name:      r.Test,
+				ClassName: r.Policy,
+				Time:      fmt.Sprintf("%.3f", r.Duration.Seconds()),
+			}
+			switch {
+			case r.Err != nil:
+				c.Error = &junitMessage{Message: r.Err.Error()}
+				suite.Errors++
+			case r.Failure != "":
+				c.Failure = &junitMessage{Message: r.Failure}
+				suite.Failures++
+			}
+			seconds += r.Duration.Seconds()
+			suite.TestCases = append(suite.TestCases, c)
+		}
+		suite.Tests = len(suite.TestCases)
+		suite.Time = fmt.Sprintf("%.3f", seconds)
+
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return errors.Wrap(err, "unable to write JUnit report")
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
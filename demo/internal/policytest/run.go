@@ -0,0 +1,99 @@
+package policytest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+// Result is the outcome of a single test.
+type Result struct {
+	Policy string
+	Test   string
+
+	// Failure describes why the verdict differs from the expected one.
+	Failure string
+
+	// Err is set when the test could not be run at all.
+	Err error
+
+	Duration time.Duration
+}
+
+// Passed returns whether the policy gave the expected verdict.
+func (r *Result) Passed() bool {
+	return r.Failure == "" && r.Err == nil
+}
+
+// Run runs every test of the suite. A policy which cannot be loaded fails all
+// of its tests.
+func (s *Suite) Run(ctx context.Context) []*Result {
+	results := []*Result{}
+	for i := range s.Policies {
+		results = append(results, s.runPolicy(ctx, &s.Policies[i])...)
+	}
+
+	return results
+}
+
+func (s *Suite) runPolicy(ctx context.Context, p *Policy) []*Result {
+	results := make([]*Result, 0, len(p.Tests))
+	for _, t := range p.Tests {
+		results = append(results, &Result{Policy: p.Name, Test: t.Name})
+	}
+	fail := func(err error) []*Result {
+		for _, r := range results {
+			r.Err = err
+		}
+		return results
+	}
+
+	settings, err := p.settings()
+	if err != nil {
+		return fail(err)
+	}
+	instance, err := policy.Open(ctx, s.module(p.Module), settings)
+	if err != nil {
+		return fail(err)
+	}
+	defer instance.Close(ctx)
+
+	for i, t := range p.Tests {
+		start := time.Now()
+		results[i].Failure, results[i].Err = s.runTest(ctx, instance, &t)
+		results[i].Duration = time.Since(start)
+	}
+
+	return results
+}
+
+func (s *Suite) runTest(ctx context.Context, p policy.Policy, t *Test) (string, error) {
+	request, err := admission.Load(s.path(t.Request))
+	if err != nil {
+		return "", err
+	}
+	response, err := p.Validate(ctx, request.Raw)
+	if err != nil {
+		return "", err
+	}
+
+	if response.Allowed != *t.Expect.Allowed {
+		if response.Allowed {
+			return "expected the request to be rejected, but it was allowed", nil
+		}
+		return fmt.Sprintf(
+			"expected the request to be allowed, but it was rejected: %s",
+			response.Message(),
+		), nil
+	}
+	if t.Expect.Message != "" && response.Message() != t.Expect.Message {
+		return fmt.Sprintf(
+			"expected message %q, got %q", t.Expect.Message, response.Message(),
+		), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,139 @@
+// Package policytest runs policies against request fixtures and checks their
+// verdicts, as they are declared in YAML test suites:
+//
+//	policies:
+//	  - name: safe-annotations
+//	    module: registry://ghcr.io/kubewarden/policies/safe-annotations:v0.1.0
+//	    settings:
+//	      constrained_annotations:
+//	        cert-manager.io/cluster-issuer: letsencrypt-production
+//	    tests:
+//	      - name: staging issuer is rejected
+//	        request: test_data/staging-ingress.json
+//	        expect:
+//	          allowed: false
+//	          message: "The following annotations are violating user constraints: cert-manager.io/cluster-issuer"
+//
+// Paths are relative to the directory of the suite.
+package policytest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+// Suite is a set of policies and the verdicts they are expected to give.
+type Suite struct {
+	// Name is the name of the suite, the file it was loaded from by default.
+	Name string `yaml:"name"`
+
+	Policies []Policy `yaml:"policies"`
+
+	dir string
+}
+
+// Policy is a policy module configured with its settings, and the tests run
+// against it.
+type Policy struct {
+	Name     string                 `yaml:"name"`
+	Module   string                 `yaml:"module"`
+	Settings map[string]interface{} `yaml:"settings"`
+	Tests    []Test                 `yaml:"tests"`
+}
+
+// Test is a request fixture and the verdict expected for it.
+type Test struct {
+	Name    string `yaml:"name"`
+	Request string `yaml:"request"`
+	Expect  Expect `yaml:"expect"`
+}
+
+// Expect is the expected verdict of a policy. The message is only checked
+// when it is set.
+type Expect struct {
+	Allowed *bool  `yaml:"allowed"`
+	Message string `yaml:"message"`
+}
+
+// Load reads and validates the test suite at path.
+func Load(path string) (*Suite, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read test suite")
+	}
+	s := &Suite{}
+	dec := yaml.NewDecoder(strings.NewReader(string(raw)))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil {
+		return nil, errors.Wrapf(err, "invalid test suite %s", path)
+	}
+	if s.Name == "" {
+		s.Name = path
+	}
+	s.dir = filepath.Dir(path)
+
+	return s, errors.Wrapf(s.validate(), "invalid test suite %s", path)
+}
+
+func (s *Suite) validate() error {
+	if len(s.Policies) == 0 {
+		return errors.New("no policies")
+	}
+	for i, p := range s.Policies {
+		if p.Module == "" {
+			return errors.Errorf("policies[%d]: no module", i)
+		}
+		if p.Name == "" {
+			s.Policies[i].Name = p.Module
+		}
+		if len(p.Tests) == 0 {
+			return errors.Errorf("policies[%d]: no tests", i)
+		}
+		for j, t := range p.Tests {
+			if t.Request == "" {
+				return errors.Errorf("policies[%d].tests[%d]: no request", i, j)
+			}
+			if t.Expect.Allowed == nil {
+				return errors.Errorf("policies[%d].tests[%d]: no expected allowed value", i, j)
+			}
+			if t.Name == "" {
+				s.Policies[i].Tests[j].Name = t.Request
+			}
+		}
+	}
+
+	return nil
+}
+
+// path resolves a path of the suite.
+func (s *Suite) path(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(s.dir, p)
+}
+
+// module resolves the module of a policy, when it is a local file.
+func (s *Suite) module(module string) string {
+	if strings.Contains(module, "://") && !strings.HasPrefix(module, "file://") {
+		return module
+	}
+
+	return s.path(strings.TrimPrefix(module, "file://"))
+}
+
+// settings returns the settings of the policy as JSON.
+func (p *Policy) settings() (json.RawMessage, error) {
+	if p.Settings == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(p.Settings)
+
+	return raw, errors.Wrapf(err, "invalid settings of policy %s", p.Name)
+}
@@ -0,0 +1,188 @@
+package script
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+)
+
+// Runtime provides what the scripts refer to by name.
+type Runtime struct {
+	// Funcs are the functions available to the command templates.
+	Funcs template.FuncMap
+
+	// Hooks are the setup and cleanup functions.
+	Hooks map[string]func() error
+
+	// Shell runs a setup or cleanup command.
+	Shell func(command string) error
+
+	// Track returns the function called after a step applying the
+	// manifest, so that its objects are removed on cleanup.
+	Track func(manifest string) func() error
+
+	// Reserved are the names the runs cannot have, as they are already
+	// flags of the demo.
+	Reserved []string
+}
+
+func (rt *Runtime) hooks() []string {
+	names := make([]string, 0, len(rt.Hooks))
+	for name := range rt.Hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (rt *Runtime) parse(line string) (*template.Template, error) {
+	return template.New("").Funcs(rt.Funcs).Option("missingkey=error").Parse(line)
+}
+
+// render executes the command templates. Templates rendering several lines
+// are shown as several lines.
+func (rt *Runtime) render(lines []string) ([]string, error) {
+	rendered := []string{}
+	for _, line := range lines {
+		t, err := rt.parse(line)
+		if err != nil {
+			return nil, err
+		}
+		b := &strings.Builder{}
+		if err := t.Execute(b, nil); err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, strings.Split(b.String(), "\n")...)
+	}
+
+	return rendered, nil
+}
+
+// Run creates the run described by the script.
+func (s *Script) Run(rt *Runtime) (*demo.Run, error) {
+	r := demo.NewRun(s.Title, s.Description...)
+	if len(s.Setup) > 0 {
+		setup, err := s.actions(rt, s.Setup)
+		if err != nil {
+			return nil, err
+		}
+		r.Setup(setup)
+	}
+	if len(s.Cleanup) > 0 {
+		cleanup, err := s.actions(rt, s.Cleanup)
+		if err != nil {
+			return nil, err
+		}
+		r.Cleanup(cleanup)
+	}
+	r.SetDefaultStepTimeout(s.StepTimeout)
+
+	for i, step := range s.Steps {
+		if err := step.add(r, rt); err != nil {
+			return nil, errors.Wrapf(err, "%s: steps[%d]", s.Path, i)
+		}
+	}
+
+	return r, nil
+}
+
+func (s *Script) actions(rt *Runtime, actions []Action) (func() error, error) {
+	fns := []func() error{}
+	for _, a := range actions {
+		if a.Hook != "" {
+			fns = append(fns, rt.Hooks[a.Hook])
+			continue
+		}
+		command, err := rt.render([]string{a.Command})
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: %s", s.Path, a.Command)
+		}
+		joined := strings.Join(command, " ")
+		fns = append(fns, func() error { return rt.Shell(joined) })
+	}
+
+	return func() error {
+		for _, fn := range fns {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (s *Step) add(r *demo.Run, rt *Runtime) error {
+	var command []string
+	if len(s.Command) > 0 {
+		var err error
+		if command, err = rt.render(s.Command); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case s.Expect != nil:
+		r.StepExpect(s.Text, command, s.Expect.expectations()...)
+	case s.CanFail:
+		r.StepCanFail(s.Text, command)
+	default:
+		r.Step(s.Text, command)
+	}
+	if s.Pipe {
+		r.UsePipe()
+	}
+	if s.HostEnv {
+		r.UseHostEnv()
+	}
+	if s.Timeout > 0 || s.OnTimeout != "" {
+		r.StepTimeout(s.Timeout, s.onTimeout())
+	}
+	for _, manifest := range s.Track {
+		r.AfterStep(rt.Track(manifest))
+	}
+
+	return nil
+}
+
+func (s *Step) onTimeout() demo.FailurePolicy {
+	switch s.OnTimeout {
+	case "continue":
+		return demo.Continue
+	case "fallback":
+		return demo.Fallback
+	}
+
+	return demo.Abort
+}
+
+func (e *Expect) expectations() []demo.Expectation {
+	expectations := []demo.Expectation{}
+	if e.ExitCode != nil {
+		expectations = append(expectations, demo.ExitCode(*e.ExitCode))
+	}
+	if e.Allowed != nil {
+		expectations = append(expectations, demo.Allowed(*e.Allowed))
+	}
+	for _, c := range []struct {
+		value string
+		fn    func(string) demo.Expectation
+	}{
+		{e.StdoutContains, demo.StdoutContains},
+		{e.StderrContains, demo.StderrContains},
+		{e.OutputContains, demo.OutputContains},
+		{e.StdoutMatches, demo.StdoutMatches},
+		{e.StderrMatches, demo.StderrMatches},
+		{e.OutputMatches, demo.OutputMatches},
+	} {
+		if c.value != "" {
+			expectations = append(expectations, c.fn(c.value))
+		}
+	}
+
+	return expectations
+}
@@ -0,0 +1,394 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+// Error is a problem found in a script.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+
+	// Path is the YAML path of the offending node, e.g. `steps[2].timeout`.
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	position := fmt.Sprintf("%s:%d", e.File, e.Line)
+	if e.Column > 0 {
+		position += fmt.Sprintf(":%d", e.Column)
+	}
+	if e.Path == "" {
+		return position + ": " + e.Message
+	}
+
+	return fmt.Sprintf("%s: %s: %s", position, e.Path, e.Message)
+}
+
+// Errors are the problems found in the scripts.
+type Errors []Error
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// The failure policies of the steps timing out.
+var onTimeoutPolicies = []string{"abort", "continue", "fallback"}
+
+var (
+	nameRegexp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	yamlLine   = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	linesType  = reflect.TypeOf(Lines{})
+)
+
+// UnmarshalYAML accepts a single string as a list of one line.
+func (l *Lines) UnmarshalYAML(n *yaml.Node) error {
+	switch {
+	case n.Kind == yaml.ScalarNode && n.Tag == "!!null":
+		*l = nil
+		return nil
+	case n.Kind == yaml.ScalarNode:
+		*l = Lines{n.Value}
+		return nil
+	}
+	lines := []string{}
+	if err := n.Decode(&lines); err != nil {
+		return err
+	}
+	*l = lines
+
+	return nil
+}
+
+// Load reads and validates every script of fsys, the `*.yaml` files of its
+// root sorted by name. Files are named after dir in the errors. All the
+// problems found are returned at once, as Errors.
+func Load(fsys fs.FS, dir string, rt *Runtime) ([]*Script, error) {
+	paths, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list scripts")
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no scripts found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	l := &loader{rt: rt, names: map[string]string{}}
+	scripts := []*Script{}
+	for _, p := range paths {
+		raw, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read script")
+		}
+		l.file = path.Join(dir, p)
+		if s := l.load(raw); s != nil {
+			s.Path = l.file
+			scripts = append(scripts, s)
+		}
+	}
+	if len(l.errors) > 0 {
+		return nil, l.errors
+	}
+
+	return scripts, nil
+}
+
+type loader struct {
+	rt     *Runtime
+	file   string
+	errors Errors
+
+	// names maps the names of the runs to the file defining them.
+	names map[string]string
+}
+
+func (l *loader) errorf(n *yaml.Node, path, format string, args ...interface{}) {
+	l.errors = append(l.errors, Error{
+		File:    l.file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// sort sorts the errors of the current file, from the first one, by line.
+func (l *loader) sort(first int) {
+	errs := l.errors[first:]
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+}
+
+// yamlError reports an error of the YAML parser or decoder, which only know
+// about lines.
+func (l *loader) yamlError(err error) {
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+	for _, m := range messages {
+		e := Error{File: l.file, Line: 1, Message: m}
+		if match := yamlLine.FindStringSubmatch(m); match != nil {
+			e.Line, _ = strconv.Atoi(match[1])
+			e.Message = match[2]
+		}
+		l.errors = append(l.errors, e)
+	}
+}
+
+func (l *loader) load(raw []byte) *Script {
+	doc := &yaml.Node{}
+	if err := yaml.NewDecoder(bytes.NewReader(raw)).Decode(doc); err != nil {
+		if err == io.EOF {
+			l.errors = append(l.errors, Error{File: l.file, Line: 1, Message: "empty script"})
+		} else {
+			l.yamlError(err)
+		}
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		l.errorf(root, "", "a script is a mapping, with a name, a title and steps")
+		return nil
+	}
+
+	// The decoder goes on after type errors, the script is validated
+	// anyway to report all the problems at once.
+	errs := len(l.errors)
+	defer l.sort(errs)
+	l.unknownFields(root, "", reflect.TypeOf(Script{}))
+	s := &Script{}
+	if err := root.Decode(s); err != nil {
+		l.yamlError(err)
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return nil
+		}
+	}
+	l.validate(root, s)
+	if len(l.errors) > errs {
+		return nil
+	}
+
+	return s
+}
+
+// unknownFields reports the keys of the mappings which are not fields of the
+// type they are decoded into.
+func (l *loader) unknownFields(n *yaml.Node, path string, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == linesType:
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields, names := map[string]reflect.Type{}, []string{}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+				names = append(names, name)
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				l.errorf(key, join(path, key.Value), "unknown field, expected one of %s", strings.Join(names, ", "))
+				continue
+			}
+			l.unknownFields(value, join(path, key.Value), ft)
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			l.unknownFields(item, fmt.Sprintf("%s[%d]", path, i), t.Elem())
+		}
+	}
+}
+
+func (l *loader) validate(root *yaml.Node, s *Script) {
+	switch {
+	case s.Name == "":
+		l.errorf(root, "name", "missing, it is the flag starting the run")
+	case !nameRegexp.MatchString(s.Name):
+		l.errorf(field(root, "name"), "name", "%q is not a valid flag name, use lowercase words separated by dashes", s.Name)
+	case strings.Trim(s.Name, "0123456789") == "":
+		l.errorf(field(root, "name"), "name", "%q is reserved, numbers are the indexes of the runs", s.Name)
+	case l.reserved(s.Name):
+		l.errorf(field(root, "name"), "name", "%q is reserved, it is already a flag of the demo", s.Name)
+	case l.names[s.Name] != "":
+		l.errorf(field(root, "name"), "name", "run %q is already defined in %s", s.Name, l.names[s.Name])
+	default:
+		l.names[s.Name] = l.file
+	}
+	if s.Title == "" {
+		l.errorf(root, "title", "missing")
+	}
+	if s.Usage == "" {
+		s.Usage = s.Title
+	}
+	if s.StepTimeout < 0 {
+		l.errorf(field(root, "stepTimeout"), "stepTimeout", "negative timeout")
+	}
+	for _, key := range []string{"setup", "cleanup"} {
+		actions := s.Setup
+		if key == "cleanup" {
+			actions = s.Cleanup
+		}
+		for i, a := range actions {
+			l.action(item(root, key, i), fmt.Sprintf("%s[%d]", key, i), a)
+		}
+	}
+	if len(s.Steps) == 0 {
+		l.errorf(root, "steps", "a run needs at least one step")
+	}
+	for i := range s.Steps {
+		l.step(item(root, "steps", i), fmt.Sprintf("steps[%d]", i), &s.Steps[i])
+	}
+}
+
+func (l *loader) reserved(name string) bool {
+	for _, r := range l.rt.Reserved {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *loader) action(n *yaml.Node, path string, a Action) {
+	switch {
+	case (a.Hook == "") == (a.Command == ""):
+		l.errorf(n, path, "either a hook or a command has to be provided")
+	case a.Hook != "" && l.rt.Hooks[a.Hook] == nil:
+		l.errorf(field(n, "hook"), path+".hook", "unknown hook %q, expected one of %s", a.Hook, strings.Join(l.rt.hooks(), ", "))
+	case a.Command != "":
+		l.template(field(n, "command"), path+".command", a.Command)
+	}
+}
+
+func (l *loader) step(n *yaml.Node, path string, s *Step) {
+	if len(s.Text) == 0 && len(s.Command) == 0 {
+		l.errorf(n, path, "a step needs a text, a command or both")
+	}
+	for i, line := range s.Command {
+		p := path + ".command"
+		if field(n, "command").Kind == yaml.SequenceNode {
+			p = fmt.Sprintf("%s[%d]", p, i)
+		}
+		l.template(lineNode(field(n, "command"), i), p, line)
+	}
+	if len(s.Command) == 0 {
+		for _, key := range []string{"canFail", "pipe", "hostEnv", "timeout", "onTimeout", "track", "expect"} {
+			if f := value(n, key); f != nil {
+				l.errorf(f, path+"."+key, "only applies to steps with a command")
+			}
+		}
+		return
+	}
+	if s.Timeout < 0 {
+		l.errorf(field(n, "timeout"), path+".timeout", "negative timeout")
+	}
+	if s.OnTimeout != "" && !contains(onTimeoutPolicies, s.OnTimeout) {
+		l.errorf(field(n, "onTimeout"), path+".onTimeout", "unknown policy %q, expected one of %s", s.OnTimeout, strings.Join(onTimeoutPolicies, ", "))
+	}
+	if s.Expect == nil {
+		return
+	}
+	if s.CanFail {
+		l.errorf(field(n, "canFail"), path+".canFail", "steps with expectations cannot fail, expect an exitCode instead")
+	}
+	expect := field(n, "expect")
+	for _, e := range []struct{ key, expr string }{
+		{"stdoutMatches", s.Expect.StdoutMatches},
+		{"stderrMatches", s.Expect.StderrMatches},
+		{"outputMatches", s.Expect.OutputMatches},
+	} {
+		if _, err := regexp.Compile(e.expr); err != nil {
+			l.errorf(field(expect, e.key), path+".expect."+e.key, "invalid regular expression: %v", err)
+		}
+	}
+}
+
+// template verifies that the command line is a valid template.
+func (l *loader) template(n *yaml.Node, path, line string) {
+	if _, err := l.rt.parse(line); err != nil {
+		l.errorf(n, path, "%s", strings.TrimPrefix(err.Error(), "template: :1: "))
+	}
+}
+
+// value returns the value of the key of the mapping n, if any.
+func value(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// field returns the value of the key of the mapping n, or n itself when it
+// is missing, to report problems about the mapping.
+func field(n *yaml.Node, key string) *yaml.Node {
+	if v := value(n, key); v != nil {
+		return v
+	}
+
+	return n
+}
+
+// item returns the i-th item of the sequence at key of the mapping n.
+func item(n *yaml.Node, key string, i int) *yaml.Node {
+	return lineNode(field(n, key), i)
+}
+
+// lineNode returns the i-th item of n when it is a sequence, n otherwise.
+func lineNode(n *yaml.Node, i int) *yaml.Node {
+	if n.Kind == yaml.SequenceNode && i < len(n.Content) {
+		return n.Content[i]
+	}
+
+	return n
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,224 @@
+package script
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"time"
+)
+
+func testRuntime() *Runtime {
+	return &Runtime{
+		Funcs:    template.FuncMap{"kwctl": func() string { return "kwctl" }},
+		Hooks:    map[string]func() error{"start-session": func() error { return nil }},
+		Reserved: []string{"help", "h", "all", "a"},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load(fstest.MapFS{
+		"10-gatekeeper.yaml": {Data: []byte(`name: gatekeeper
+title: Running a gatekeeper policy
+stepTimeout: 1m
+setup:
+  - hook: start-session
+steps:
+  - text: The echo policy
+  - text: Run the policy
+    command:
+      - "{{kwctl}} run"
+      - policy.wasm
+    timeout: 10s
+    onTimeout: continue
+`)},
+	}, "scripts", testRuntime())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s) != 1 {
+		t.Fatalf("expected 1 script, got %d", len(s))
+	}
+	got := s[0]
+	if got.Name != "gatekeeper" || got.Path != "scripts/10-gatekeeper.yaml" {
+		t.Errorf("unexpected script %q loaded from %q", got.Name, got.Path)
+	}
+	if got.Usage != got.Title {
+		t.Errorf("expected the usage to default to the title, got %q", got.Usage)
+	}
+	if got.StepTimeout != time.Minute {
+		t.Errorf("expected a step timeout of 1m, got %s", got.StepTimeout)
+	}
+	if len(got.Steps) != 2 || len(got.Steps[1].Command) != 2 || got.Steps[1].Timeout != 10*time.Second {
+		t.Errorf("unexpected steps %+v", got.Steps)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		err    string
+	}{
+		{
+			name:   "empty",
+			script: ``,
+			err:    "scripts/10-test.yaml:1: empty script",
+		},
+		{
+			name:   "not a mapping",
+			script: `- name: test`,
+			err:    "scripts/10-test.yaml:1:1: a script is a mapping",
+		},
+		{
+			name:   "invalid YAML",
+			script: "name: test\n  title: [",
+			err:    "scripts/10-test.yaml:2: ",
+		},
+		{
+			name:   "missing name",
+			script: "title: Test\nsteps:\n  - text: hello\n",
+			err:    "scripts/10-test.yaml:1:1: name: missing, it is the flag starting the run",
+		},
+		{
+			name:   "invalid name",
+			script: "name: Test_Run\ntitle: Test\nsteps:\n  - text: hello\n",
+			err:    `scripts/10-test.yaml:1:7: name: "Test_Run" is not a valid flag name`,
+		},
+		{
+			name:   "numeric name",
+			script: "name: \"2\"\ntitle: Test\nsteps:\n  - text: hello\n",
+			err:    `scripts/10-test.yaml:1:7: name: "2" is reserved, numbers are the indexes of the runs`,
+		},
+		{
+			name:   "flag name",
+			script: "name: all\ntitle: Test\nsteps:\n  - text: hello\n",
+			err:    `scripts/10-test.yaml:1:7: name: "all" is reserved, it is already a flag of the demo`,
+		},
+		{
+			name:   "flag alias",
+			script: "name: h\ntitle: Test\nsteps:\n  - text: hello\n",
+			err:    `scripts/10-test.yaml:1:7: name: "h" is reserved, it is already a flag of the demo`,
+		},
+		{
+			name:   "missing title",
+			script: "name: test\nsteps:\n  - text: hello\n",
+			err:    "scripts/10-test.yaml:1:1: title: missing",
+		},
+		{
+			name:   "no steps",
+			script: "name: test\ntitle: Test\n",
+			err:    "scripts/10-test.yaml:1:1: steps: a run needs at least one step",
+		},
+		{
+			name:   "unknown field",
+			script: "name: test\ntitle: Test\nsteps:\n  - text: hello\n    cmd: ls\n",
+			err:    "scripts/10-test.yaml:5:5: steps[0].cmd: unknown field, expected one of text, command",
+		},
+		{
+			name:   "unknown hook",
+			script: "name: test\ntitle: Test\nsetup:\n  - hook: nope\nsteps:\n  - text: hello\n",
+			err:    `scripts/10-test.yaml:4:11: setup[0].hook: unknown hook "nope", expected one of start-session`,
+		},
+		{
+			name:   "hook and command",
+			script: "name: test\ntitle: Test\ncleanup:\n  - hook: start-session\n    command: ls\nsteps:\n  - text: hello\n",
+			err:    "scripts/10-test.yaml:4:5: cleanup[0]: either a hook or a command has to be provided",
+		},
+		{
+			name:   "invalid template",
+			script: "name: test\ntitle: Test\nsteps:\n  - command:\n      - ls\n      - \"{{kwctl\"\n",
+			err:    "scripts/10-test.yaml:6:9: steps[0].command[1]: ",
+		},
+		{
+			name:   "unknown function",
+			script: "name: test\ntitle: Test\nsteps:\n  - command: \"{{opa}} build\"\n",
+			err:    `scripts/10-test.yaml:4:14: steps[0].command: function "opa" not defined`,
+		},
+		{
+			name:   "negative step timeout",
+			script: "name: test\ntitle: Test\nstepTimeout: -1s\nsteps:\n  - text: hello\n",
+			err:    "scripts/10-test.yaml:3:14: stepTimeout: negative timeout",
+		},
+		{
+			name:   "negative timeout",
+			script: "name: test\ntitle: Test\nsteps:\n  - command: ls\n    timeout: -1s\n",
+			err:    "scripts/10-test.yaml:5:14: steps[0].timeout: negative timeout",
+		},
+		{
+			name:   "unknown timeout policy",
+			script: "name: test\ntitle: Test\nsteps:\n  - command: ls\n    onTimeout: retry\n",
+			err:    `scripts/10-test.yaml:5:16: steps[0].onTimeout: unknown policy "retry", expected one of abort, continue, fallback`,
+		},
+		{
+			name:   "option without a command",
+			script: "name: test\ntitle: Test\nsteps:\n  - text: hello\n    canFail: true\n",
+			err:    "scripts/10-test.yaml:5:14: steps[0].canFail: only applies to steps with a command",
+		},
+		{
+			name:   "empty step",
+			script: "name: test\ntitle: Test\nsteps:\n  - pipe: false\n",
+			err:    "scripts/10-test.yaml:4:5: steps[0]: a step needs a text, a command or both",
+		},
+		{
+			name:   "expectations of a step that can fail",
+			script: "name: test\ntitle: Test\nsteps:\n  - command: ls\n    canFail: true\n    expect:\n      exitCode: 1\n",
+			err:    "scripts/10-test.yaml:5:14: steps[0].canFail: steps with expectations cannot fail",
+		},
+		{
+			name:   "invalid regular expression",
+			script: "name: test\ntitle: Test\nsteps:\n  - command: ls\n    expect:\n      stdoutMatches: \"(\"\n",
+			err:    "scripts/10-test.yaml:6:22: steps[0].expect.stdoutMatches: invalid regular expression",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(fstest.MapFS{"10-test.yaml": {Data: []byte(tc.script)}}, "scripts", testRuntime())
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tc.err)
+			}
+			if _, ok := err.(Errors); !ok {
+				t.Errorf("expected Errors, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %q", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadDuplicateNames(t *testing.T) {
+	script := []byte("name: test\ntitle: Test\nsteps:\n  - text: hello\n")
+	_, err := Load(fstest.MapFS{
+		"10-test.yaml": {Data: script},
+		"20-test.yaml": {Data: script},
+	}, "scripts", testRuntime())
+	expected := `scripts/20-test.yaml:1:7: name: run "test" is already defined in scripts/10-test.yaml`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	_, err := Load(fstest.MapFS{
+		"10-first.yaml":  {Data: []byte("name: first\nsteps:\n  - command: ls\n    timeout: -1s\n")},
+		"20-second.yaml": {Data: []byte("name: Second\ntitle: Second\nsteps:\n  - text: hello\n")},
+	}, "scripts", testRuntime())
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	got := []string{}
+	for _, e := range errs {
+		got = append(got, e.File+":"+e.Path)
+	}
+	expected := "scripts/10-first.yaml:title scripts/10-first.yaml:steps[0].timeout scripts/20-second.yaml:name"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("expected %q, got %q", expected, strings.Join(got, " "))
+	}
+}
+
+func TestLoadNoScripts(t *testing.T) {
+	if _, err := Load(fstest.MapFS{}, "scripts", testRuntime()); err == nil || err.Error() != "no scripts found in scripts" {
+		t.Errorf("expected no scripts to be found, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package script loads the runs of the demo from YAML scripts:
+//
+//	name: gatekeeper
+//	usage: gatekeeper policy build and run demo
+//	title: Running a gatekeeper policy
+//	stepTimeout: 1m
+//	steps:
+//	  - text: The echo policy
+//	  - text: "Run policy: accept the request"
+//	    command:
+//	      - "{{kwctl}} run -e gatekeeper"
+//	      - "--settings-json '{\"reject\":false}'"
+//	      - "--request-path test_data/empty-request.json gatekeeper/policy.wasm | jq"
+//	    pipe: true
+//	    expect:
+//	      allowed: true
+//
+// The name is the flag starting the run. Commands are text/template
+// templates, rendered with the functions of the Runtime, and every line of a
+// command is shown on a line of its own. Setup and cleanup are lists of
+// hooks provided by the Runtime, or of shell commands.
+package script
+
+import "time"
+
+// Script describes a run.
+type Script struct {
+	Name        string `yaml:"name"`
+	Usage       string `yaml:"usage"`
+	Title       string `yaml:"title"`
+	Description Lines  `yaml:"description"`
+
+	// StepTimeout is the time each step command may take, unless the step
+	// has a timeout of its own.
+	StepTimeout time.Duration `yaml:"stepTimeout"`
+
+	Setup   []Action `yaml:"setup"`
+	Cleanup []Action `yaml:"cleanup"`
+	Steps   []Step   `yaml:"steps"`
+
+	// Path is the file the script was loaded from.
+	Path string `yaml:"-"`
+}
+
+// Action is a setup or cleanup action: a hook of the Runtime, or a shell
+// command.
+type Action struct {
+	Hook    string `yaml:"hook"`
+	Command string `yaml:"command"`
+}
+
+// Step is a step of the run. Steps without a command only show their text.
+type Step struct {
+	Text    Lines `yaml:"text"`
+	Command Lines `yaml:"command"`
+	CanFail bool  `yaml:"canFail"`
+
+	// Pipe runs the command with its output piped instead of in a
+	// pseudo-terminal, for clean output to check expectations against.
+	Pipe    bool `yaml:"pipe"`
+	HostEnv bool `yaml:"hostEnv"`
+
+	Timeout   time.Duration `yaml:"timeout"`
+	OnTimeout string        `yaml:"onTimeout"`
+
+	// Track lists the manifests applied by the command, whose objects are
+	// removed on cleanup.
+	Track  Lines   `yaml:"track"`
+	Expect *Expect `yaml:"expect"`
+}
+
+// Expect lists the expectations of a step, all of them have to be met.
+type Expect struct {
+	ExitCode       *int   `yaml:"exitCode"`
+	Allowed        *bool  `yaml:"allowed"`
+	StdoutContains string `yaml:"stdoutContains"`
+	StderrContains string `yaml:"stderrContains"`
+	OutputContains string `yaml:"outputContains"`
+	StdoutMatches  string `yaml:"stdoutMatches"`
+	StderrMatches  string `yaml:"stderrMatches"`
+	OutputMatches  string `yaml:"outputMatches"`
+}
+
+// Lines is a list of lines, written as a list or as a single string.
+type Lines []string
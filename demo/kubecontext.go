@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/apiserver"
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+)
+
+const (
+	flagAllowedContexts     = "allowed-contexts"
+	flagAllowedContextsFile = "allowed-contexts-file"
+)
+
+// defaultAllowedContexts match the usual names of local development
+// clusters.
+var defaultAllowedContexts = []string{
+	"kind-*", "k3d-*", "minikube", "docker-desktop", "rancher-desktop",
+}
+
+// mutatingSubcommands are the kubectl subcommands changing the cluster.
+var mutatingSubcommands = map[string]bool{
+	"annotate": true,
+	"apply":    true,
+	"create":   true,
+	"delete":   true,
+	"edit":     true,
+	"label":    true,
+	"patch":    true,
+	"replace":  true,
+	"scale":    true,
+}
+
+// kubectlValueFlags are the global kubectl flags taking the next word as
+// their value.
+var kubectlValueFlags = map[string]bool{
+	"-n":           true,
+	"--namespace":  true,
+	"--context":    true,
+	"--cluster":    true,
+	"--kubeconfig": true,
+	"-s":           true,
+	"--server":     true,
+	"--user":       true,
+}
+
+// commandWrappers run the command given as their arguments.
+var commandWrappers = map[string]bool{
+	"command": true,
+	"env":     true,
+	"exec":    true,
+	"nice":    true,
+	"sudo":    true,
+	"time":    true,
+}
+
+func allowedContextsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name: flagAllowedContexts,
+			Usage: "kube-context or cluster name patterns runs changing the cluster " +
+				"are allowed to use (default: " + strings.Join(defaultAllowedContexts, ", ") + ")",
+		},
+		&cli.PathFlag{
+			Name:  flagAllowedContextsFile,
+			Usage: "file with one allowed kube-context or cluster name pattern per line",
+			Value: filepath.Join(userConfigDir(), "kubecon-na-21", "allowed-contexts"),
+		},
+	}
+}
+
+func userConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+
+	return dir
+}
+
+// guardContext refuses to start runs changing the cluster when the current
+// kube-context is not allowed, and shows the context in the header of those
+// runs.
+func guardContext(ctx *cli.Context, r *demo.Run) error {
+	// Nothing runs against the cluster when replaying.
+	if !mutatesCluster(r) || ctx.String(demo.FlagReplay) != "" {
+		return nil
+	}
+
+	context, cluster, err := currentContext()
+	if err != nil {
+		return errors.Wrapf(err, "unable to find out the current kube-context for %q", r.Title())
+	}
+	r.SetHeader(fmt.Sprintf("kube-context: %s (cluster %s)", context, cluster))
+
+	allowed, ok, err := contextAllowed(ctx, context, cluster)
+	if err != nil || ok {
+		return err
+	}
+
+	return errors.Errorf(
+		"refusing to run %q against kube-context %q (cluster %q), allowed: %s",
+		r.Title(), context, cluster, strings.Join(allowed, ", "),
+	)
+}
+
+// contextAllowed returns whether runs changing the cluster may use the
+// kube-context or the cluster, and the allowed patterns.
+func contextAllowed(ctx *cli.Context, context, cluster string) ([]string, bool, error) {
+	allowed, err := allowedContexts(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, pattern := range allowed {
+		for _, name := range []string{context, cluster} {
+			if ok, _ := path.Match(pattern, name); ok {
+				return allowed, true, nil
+			}
+		}
+	}
+
+	return allowed, false, nil
+}
+
+func allowedContexts(ctx *cli.Context) ([]string, error) {
+	allowed := []string{apiserver.Name}
+	fromFlag := ctx.StringSlice(flagAllowedContexts)
+	allowed = append(allowed, fromFlag...)
+
+	fromFile, err := readPatterns(ctx.Path(flagAllowedContextsFile))
+	if err != nil {
+		return nil, err
+	}
+	allowed = append(allowed, fromFile...)
+
+	if len(fromFlag) == 0 && len(fromFile) == 0 {
+		allowed = append(allowed, defaultAllowedContexts...)
+	}
+
+	return allowed, nil
+}
+
+// readPatterns reads one pattern per line, ignoring empty lines and comments.
+// A missing file contains no patterns.
+func readPatterns(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "unable to read allowed contexts")
+	}
+	defer f.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns, errors.Wrapf(scanner.Err(), "unable to read %s", file)
+}
+
+// currentContext returns the current kube-context and its cluster, read one
+// at a time as their names may contain spaces.
+func currentContext() (context, cluster string, err error) {
+	out, err := kubectl("config", "view", "-o", "jsonpath={.current-context}").Output()
+	if err != nil {
+		return "", "", err
+	}
+	if context = string(out); context == "" {
+		return "", "", errors.New("no current kube-context")
+	}
+	out, err = kubectl("config", "view", "--minify", "-o", "jsonpath={.clusters[0].name}").Output()
+	if err != nil {
+		return "", "", err
+	}
+	if cluster = string(out); cluster == "" {
+		return "", "", errors.Errorf("no cluster for kube-context %q", context)
+	}
+
+	return context, cluster, nil
+}
+
+// mutatesCluster returns whether the run sets up the cluster or has steps
+// changing it.
+func mutatesCluster(r *demo.Run) bool {
+	if r.HasSetup() {
+		return true
+	}
+	for _, command := range r.Commands() {
+		if mutatingCommand(command) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mutatingCommand returns whether any of the commands of the shell command
+// runs a kubectl subcommand changing the cluster.
+func mutatingCommand(command string) bool {
+	for _, words := range simpleCommands(command) {
+		words = unwrap(words)
+		if len(words) == 0 || filepath.Base(words[0]) != "kubectl" {
+			continue
+		}
+		if mutatingSubcommands[kubectlSubcommand(words[1:])] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// kubectlSubcommand returns the subcommand given the arguments of kubectl,
+// skipping the flags before it.
+func kubectlSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case kubectlValueFlags[args[i]]:
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		}
+	}
+
+	return ""
+}
+
+// unwrap returns the command run by wrappers like sudo, without their options
+// and the environment variables they set.
+func unwrap(words []string) []string {
+	for len(words) > 0 && commandWrappers[filepath.Base(words[0])] {
+		words = words[1:]
+		for len(words) > 0 && (strings.HasPrefix(words[0], "-") || isAssignment(words[0])) {
+			words = words[1:]
+		}
+	}
+
+	return words
+}
+
+func isControlOperator(word string) bool {
+	return word == "|" || word == "&&" || word == "||" || word == ";"
+}
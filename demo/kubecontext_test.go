@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMutatingCommand(t *testing.T) {
+	for _, tc := range []struct {
+		command  string
+		mutating bool
+	}{
+		{"kubectl apply -f a.yaml", true},
+		{"kubectl get pods", false},
+		{"kubectl -n kubewarden delete pod a", true},
+		{"kubectl --context=kind-demo label ns a b=c", true},
+		{"kubectl get pods -o name | kubectl delete -f -", true},
+		{"kubectl get pods && kubectl create ns a", true},
+		{"true; kubectl patch ns a -p '{}'", true},
+		{"FOO=1 kubectl apply -f a.yaml", true},
+		{"sudo kubectl apply -f a.yaml", true},
+		{"sudo -E env KUBECONFIG=a /usr/local/bin/kubectl scale deploy a --replicas 2", true},
+		{"echo kubectl apply -f a.yaml", false},
+		{"kubectl explain apply", false},
+	} {
+		if got := mutatingCommand(tc.command); got != tc.mutating {
+			t.Errorf("%s: expected %v, got %v", tc.command, tc.mutating, got)
+		}
+	}
+}
+
+func TestCurrentContext(t *testing.T) {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		t.Skip("kubectl is not installed")
+	}
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: the cluster
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: other
+  context:
+    cluster: other
+- name: the context
+  context:
+    cluster: the cluster
+current-context: the context
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	context, cluster, err := currentContext()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if context != "the context" || cluster != "the cluster" {
+		t.Errorf("expected the context %q of cluster %q, got %q of %q", "the context", "the cluster", context, cluster)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/admission"
+	"github.com/ereslibre/kubecon-na-21/internal/policy"
+)
+
+// kwctl returns the command used by the steps to run policies: the real kwctl
+// when it is installed, and our builtin evaluator run by builtin otherwise.
+func kwctl(builtin func(subcommand string) string) string {
+	if _, err := exec.LookPath("kwctl"); err == nil {
+		return "kwctl"
+	}
+
+	return builtin("kwctl")
+}
+
+// builtin returns the shell command running one of our own subcommands.
+func builtin(subcommand string) string {
+	self, err := os.Executable()
+	if err != nil {
+		self = os.Args[0]
+	}
+
+	return fmt.Sprintf("%q %s", self, subcommand)
+}
+
+// kwctlCommand mimics the subset of `kwctl run` used by the demo, evaluating
+// the policies in-process.
+func kwctlCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "kwctl",
+		Usage: "kwctl compatible policy evaluation, without kwctl",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "verbose",
+				Aliases: []string{"v"},
+				Usage:   "print the policy traces",
+			},
+		},
+		Subcommands: []*cli.Command{{
+			Name:      "run",
+			Usage:     "run a policy against a request",
+			ArgsUsage: "<policy.wasm>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "execution-mode",
+					Aliases: []string{"e"},
+					Usage:   "the runtime to use to execute the policy",
+					Value:   "gatekeeper",
+				},
+				&cli.StringFlag{
+					Name:    "request-path",
+					Aliases: []string{"r"},
+					Usage:   "file containing the AdmissionRequest",
+				},
+				&cli.StringFlag{
+					Name:  "settings-json",
+					Usage: "settings of the policy as a JSON document",
+				},
+				&cli.StringFlag{
+					Name:  "settings-path",
+					Usage: "file containing the settings of the policy",
+				},
+			},
+			Action: kwctlRun,
+		}},
+	}
+}
+
+func kwctlRun(ctx *cli.Context) error {
+	if mode := ctx.String("execution-mode"); mode != "gatekeeper" {
+		return errors.Errorf("unsupported execution mode %q", mode)
+	}
+	if ctx.NArg() != 1 {
+		return errors.New("exactly one policy has to be provided")
+	}
+	request, err := admission.Load(ctx.String("request-path"))
+	if err != nil {
+		return err
+	}
+	settings := []byte(ctx.String("settings-json"))
+	if path := ctx.String("settings-path"); path != "" {
+		if settings, err = os.ReadFile(path); err != nil {
+			return errors.Wrap(err, "unable to read settings")
+		}
+	}
+
+	response, traces, err := evaluateGatekeeper(
+		strings.TrimPrefix(ctx.Args().First(), "file://"), request.Raw, settings,
+	)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("verbose") {
+		for _, t := range traces {
+			fmt.Fprintf(os.Stderr, "TRACE policy: %s\n", t)
+		}
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(response)
+}
+
+func evaluateGatekeeper(
+	path string, request, settings []byte,
+) (*policy.ValidationResponse, []string, error) {
+	ctx := context.Background()
+	p, err := policy.LoadGatekeeper(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer p.Close(ctx)
+
+	return p.Validate(ctx, request, settings)
+}
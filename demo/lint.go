@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+	"github.com/ereslibre/kubecon-na-21/internal/kubewarden"
+)
+
+func lintCommand(d *demo.Demo) *cli.Command {
+	return &cli.Command{
+		Name:      "lint",
+		Usage:     "verify the ClusterAdmissionPolicy and AdmissionPolicy manifests",
+		ArgsUsage: "[manifest.yaml]...",
+		Description: "Without arguments, the policy manifests used by the runs are " +
+			"verified, relative to the current directory.",
+		Action: func(ctx *cli.Context) error {
+			paths := ctx.Args().Slice()
+			if len(paths) == 0 {
+				seen := map[string]bool{}
+				for _, r := range d.Runs() {
+					for _, path := range policyManifests(r, ".") {
+						if !seen[path] {
+							seen[path] = true
+							paths = append(paths, path)
+						}
+					}
+				}
+			}
+
+			return lintManifests(".", paths)
+		},
+	}
+}
+
+// lintRun verifies the policy manifests used by the run, before anything is
+// applied to the cluster.
+func lintRun(r *demo.Run) error {
+	return errors.Wrapf(
+		lintManifests(workDir(), policyManifests(r, workDir())),
+		"refusing to run %q", r.Title(),
+	)
+}
+
+// policyManifests returns the manifests used by the steps of the run holding
+// Kubewarden policies, relative to dir. Every manifest applied with kubectl,
+// and every other YAML file the steps refer to, is considered. Files which
+// cannot be parsed are returned too, so that they are reported, missing
+// files are left to the steps.
+func policyManifests(r *demo.Run, dir string) []string {
+	candidates := []string{}
+	for _, command := range r.Commands() {
+		candidates = append(candidates, appliedManifests(command)...)
+		for _, f := range commandFiles(command) {
+			if ext := filepath.Ext(f); ext == ".yaml" || ext == ".yml" {
+				candidates = append(candidates, f)
+			}
+		}
+	}
+
+	manifests, seen := []string{}, map[string]bool{}
+	for _, f := range candidates {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		file := f
+		if !filepath.IsAbs(f) {
+			file = filepath.Join(dir, f)
+		}
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		if ok, err := kubewarden.ContainsPolicy(file); ok || err != nil {
+			manifests = append(manifests, f)
+		}
+	}
+
+	return manifests
+}
+
+// appliedManifests returns the files applied by the kubectl apply commands of
+// a shell command.
+func appliedManifests(command string) []string {
+	manifests := []string{}
+	kubectl, apply := false, false
+	words := shellWords(command)
+	for i, word := range words {
+		switch {
+		case isControlOperator(word):
+			kubectl, apply = false, false
+		case !kubectl:
+			kubectl = word == "kubectl" && (i == 0 || isControlOperator(words[i-1]))
+		case !apply:
+			apply = word == "apply"
+		case (word == "-f" || word == "--filename") && i+1 < len(words):
+			manifests = append(manifests, filepath.Clean(words[i+1]))
+		case strings.HasPrefix(word, "-f="), strings.HasPrefix(word, "--filename="):
+			manifests = append(manifests, filepath.Clean(word[strings.Index(word, "=")+1:]))
+		}
+	}
+
+	return manifests
+}
+
+// lintManifests prints the problems of the manifests, relative to dir, and
+// fails when any of them is an error.
+func lintManifests(dir string, paths []string) error {
+	errs := 0
+	for _, path := range paths {
+		file := path
+		if !filepath.IsAbs(path) {
+			file = filepath.Join(dir, path)
+		}
+		problems, err := kubewarden.Lint(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, color.Red.Sprint(err))
+			errs++
+			continue
+		}
+		for _, p := range problems {
+			p.File = path
+			line := color.Yellow.Sprint(p)
+			if !p.Warning {
+				line = color.Red.Sprint(p)
+			}
+			fmt.Fprintln(os.Stderr, line)
+		}
+		errs += kubewarden.Errors(problems)
+	}
+
+	if errs > 0 {
+		return errors.Errorf("%d error(s) in the policy manifests %s", errs, strings.Join(paths, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppliedManifests(t *testing.T) {
+	for _, tc := range []struct {
+		command   string
+		manifests []string
+	}{
+		{"kubectl apply -f manifests/policy.yaml", []string{"manifests/policy.yaml"}},
+		{"kubectl -n kubewarden apply --filename ./manifests/policy.yaml", []string{"manifests/policy.yaml"}},
+		{"kubectl apply -f=a.yaml --filename=b.yaml", []string{"a.yaml", "b.yaml"}},
+		{"kubectl apply -f 'with space.yaml'", []string{"with space.yaml"}},
+		{"kubectl apply -f a.yaml && kubectl apply -f b.yaml", []string{"a.yaml", "b.yaml"}},
+		{"kubectl delete -f a.yaml; kubectl apply -f b.yaml", []string{"b.yaml"}},
+		{"kubectl get -f a.yaml -o yaml | kubectl apply -f -", []string{"-"}},
+		{"echo kubectl apply -f a.yaml", []string{}},
+		{"kubectl create -f a.yaml", []string{}},
+	} {
+		if got := appliedManifests(tc.command); !reflect.DeepEqual(got, tc.manifests) {
+			t.Errorf("%s: expected %q, got %q", tc.command, tc.manifests, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/apiserver"
+)
+
+const flagLocalCluster = "local-cluster"
+
+var localCluster *apiserver.Server
+
+func localClusterFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  flagLocalCluster,
+		Usage: "run kubectl against an in-process API server instead of a real cluster",
+	}
+}
+
+// setupLocalCluster starts the in-process API server when requested, and
+// points kubectl to it for the rest of the run.
+func setupLocalCluster(ctx *cli.Context) error {
+	if ctx == nil || !ctx.Bool(flagLocalCluster) || localCluster != nil {
+		return nil
+	}
+	s, err := apiserver.Start()
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := s.Kubeconfig()
+	if err != nil {
+		s.Close()
+		return err
+	}
+	localCluster = s
+
+	return os.Setenv("KUBECONFIG", kubeconfig)
+}
+
+func cleanupLocalCluster(*cli.Context) error {
+	if localCluster == nil {
+		return nil
+	}
+	err := localCluster.Close()
+	localCluster = nil
+
+	return err
+}
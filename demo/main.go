@@ -1,134 +1,67 @@
 package main
 
 import (
+	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
 
-	demo "github.com/saschagrunert/demo"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
 )
 
 func main() {
 	d := demo.New()
-	d.Add(policyServerRun(), "policy-server demo", "policy-server demo")
-	d.Add(gatekeeperPolicyBuildAndRun(), "gatekeeper policy build and run demo", "gatekeeper policy build and run demo")
+	d.Commands = append(d.Commands, kwctlCommand(), opaCommand(), evaluateCommand(), matrixCommand(), listCommand(d), showCommand(d), testCommand(), fixturesCommand(), lintCommand(d), explainCommand(d), doctorCommand(d))
+	d.Flags = append(d.Flags, localClusterFlag(), dryRunCleanupFlag(), rehearseFlag())
+	d.Flags = append(d.Flags, allowedContextsFlags()...)
+
+	// The runs are started by flags of their own, added once every other
+	// flag is known.
+	scriptRuntime.Reserved = []string{"help", "h", "version", "v"}
+	for _, f := range d.Flags {
+		scriptRuntime.Reserved = append(scriptRuntime.Reserved, f.Names()...)
+	}
+	scripts, err := loadScripts()
+	if err == nil {
+		err = addRuns(d, scripts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	d.Setup(setupDemo)
+	d.BeforeRun(beforeRun)
+	d.Availability(available)
+	d.Cleanup(cleanupDemo)
 	d.Run()
 }
 
-func policyServerRun() *demo.Run {
-	r := demo.NewRun(
-		"Running policies on the policy-server",
-	)
-
-	r.Setup(setupKubernetes)
-	r.Cleanup(cleanupKubernetes)
-
-	policyServer(r)
-
-	return r
-}
-
-func policyServer(r *demo.Run) {
-	r.Step(demo.S(
-		"The problem and the safe-annotations policy",
-	), nil)
-
-	r.Step(demo.S(
-		"Show cluster admission policy",
-	), demo.S("bat test_data/letsencrypt-production-manifest.yaml"))
-
-	r.Step(demo.S(
-		"Deploy cluster admission policy",
-	), demo.S(
-		"kubectl apply -f test_data/letsencrypt-production-manifest.yaml",
-	))
-
-	r.Step(demo.S(
-		"Wait for our policy to be active",
-	), demo.S(
-		"kubectl wait --for=condition=PolicyServerWebhookConfigurationReconciled clusteradmissionpolicy letsencrypt-production-ingress",
-	))
-
-	r.Step(demo.S(
-		"Ingress with a letsencrypt-production issuer",
-	), demo.S("bat test_data/production-ingress-resource.yaml"))
-
-	r.Step(demo.S(
-		"Deploy an Ingress resource with a letsencrypt-production issuer",
-	), demo.S("kubectl apply -f test_data/production-ingress-resource.yaml"))
-
-	r.Step(demo.S(
-		"Ingress with a letsencrypt-staging issuer",
-	), demo.S("bat test_data/staging-ingress-resource.yaml"))
-
-	r.StepCanFail(demo.S(
-		"Deploy an Ingress resource with a letsencrypt-staging issuer",
-	), demo.S("kubectl apply -f test_data/staging-ingress-resource.yaml"))
+func setupDemo(ctx *cli.Context) error {
+	dryRunCleanup = ctx.Bool(flagDryRunCleanup)
+	if err := createSessionDir(); err != nil {
+		return err
+	}
+	return setupLocalCluster(ctx)
 }
 
-func gatekeeperPolicyBuildAndRun() *demo.Run {
-	r := demo.NewRun(
-		"Running a gatekeeper policy",
-	)
-	r.Step(demo.S(
-		"The echo policy",
-	), nil)
-
-	r.Step(demo.S(
-		"Build policy",
-	), demo.S(
-		"opa build -t wasm -e echo/violation -o gatekeeper/bundle.tar.gz gatekeeper/echo.rego &&",
-		"tar -C gatekeeper -xf gatekeeper/bundle.tar.gz /policy.wasm",
-	))
-
-	r.Step(demo.S("kwctl: the Kubewarden go-to tool"), nil)
-
-	r.Step(demo.S(
-		"Run policy: accept the request",
-	), demo.S(
-		"kwctl run -e gatekeeper",
-		`--settings-json '{"reject":false}'`,
-		"--request-path test_data/empty-request.json",
-		"gatekeeper/policy.wasm | jq",
-	))
-
-	r.Step(demo.S(
-		"Run policy: reject the request",
-	), demo.S(
-		"kwctl run -e gatekeeper",
-		`--settings-json '{"reject":true, "rejection_message": "this is the rejection message itself"}'`,
-		"--request-path test_data/empty-request.json",
-		"gatekeeper/policy.wasm | jq",
-	))
-
-	r.Step(demo.S(
-		"Run policy: reject the request -- now in verbosity mode",
-	), demo.S(
-		"kwctl -v run -e gatekeeper",
-		`--settings-json '{"reject":true, "rejection_message": "this is the rejection message itself"}'`,
-		"--request-path test_data/empty-request.json",
-		"gatekeeper/policy.wasm | jq",
-	))
-
-	return r
-}
-
-func cleanupKwctl() error {
-	os.RemoveAll(filepath.Join(os.Getenv("HOME"), ".cache", "kubewarden"))
-	return nil
-}
-
-func setupKubernetes() error {
-	cleanupKwctl()
-	cleanupKubernetes()
-	exec.Command("kubectl", "create", "namespace", "kubecon-na-21").Run()
-	exec.Command("kubectl", "delete", "clusteradmissionpolicy", "--all").Run()
+func beforeRun(ctx *cli.Context, r *demo.Run) error {
+	if err := guardContext(ctx, r); err != nil {
+		return err
+	}
+	if err := lintRun(r); err != nil {
+		return err
+	}
+	if err := rehearse(ctx, r); err != nil {
+		return err
+	}
+	r.SetEnv(sessionEnv()...)
+	r.SetDir(workDir())
 	return nil
 }
 
-func cleanupKubernetes() error {
-	cleanupKwctl()
-	exec.Command("kubectl", "delete", "namespace", "kubecon-na-21").Run()
-	exec.Command("kubectl", "delete", "clusteradmissionpolicy", "--all").Run()
-	return nil
+func cleanupDemo(ctx *cli.Context) error {
+	if err := cleanupLocalCluster(ctx); err != nil {
+		return err
+	}
+	return removeSessionDir()
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/kubewarden"
+	"github.com/ereslibre/kubecon-na-21/internal/matrix"
+)
+
+// echoVariants are the settings the gatekeeper echo policy is shown with.
+var echoVariants = []struct {
+	name     string
+	settings string
+}{
+	{"echo accepting", `{"reject":false}`},
+	{"echo rejecting", `{"reject":true,"rejection_message":"this is the rejection message itself"}`},
+	{"echo rejecting, other message", `{"reject":true,"rejection_message":"rejected by the echo policy"}`},
+}
+
+func matrixCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "matrix",
+		Usage:     "evaluate every policy against every request offline, and print the verdicts as a matrix",
+		ArgsUsage: "[request.json]...",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "policy",
+				Aliases: []string{"p"},
+				Usage:   "a ClusterAdmissionPolicy manifest to add to the matrix",
+				Value:   cli.NewStringSlice("test_data/letsencrypt-production-manifest.yaml"),
+			},
+			&cli.PathFlag{
+				Name:  "wasm",
+				Usage: "the gatekeeper echo policy, shown with each of its settings variants",
+				Value: "gatekeeper/policy.wasm",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "the matrix format: text, markdown or csv",
+				Value:   matrix.FormatText,
+			},
+		},
+		Action: printMatrix,
+	}
+}
+
+func printMatrix(ctx *cli.Context) error {
+	requests := ctx.Args().Slice()
+	if len(requests) == 0 {
+		var err error
+		if requests, err = filepath.Glob("test_data/*.json"); err != nil {
+			return err
+		}
+	}
+	if len(requests) == 0 {
+		return errors.New("no request fixtures found in test_data")
+	}
+
+	policies := []matrix.Policy{}
+	if wasm := ctx.Path("wasm"); wasm != "" {
+		for _, v := range echoVariants {
+			policies = append(policies, matrix.Policy{
+				Name:     v.name,
+				Module:   wasm,
+				Settings: json.RawMessage(v.settings),
+			})
+		}
+	}
+	for _, path := range ctx.StringSlice("policy") {
+		p, err := kubewarden.Load(path)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, matrix.Policy{
+			Name:     p.Metadata.Name,
+			Module:   p.Spec.Module,
+			Settings: p.Spec.Settings,
+		})
+	}
+
+	m, err := matrix.Evaluate(context.Background(), policies, requests)
+	if err != nil {
+		return err
+	}
+	if err := matrix.Write(os.Stdout, ctx.String("output"), m); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, verdicts := range m.Verdicts {
+		for _, v := range verdicts {
+			if v.Err != nil {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d evaluations failed", failed)
+	}
+
+	return nil
+}
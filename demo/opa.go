@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/opa"
+)
+
+// buildPolicy returns the command used by the steps to build the rego
+// policy into policy.wasm: the real opa and tar when opa is installed, and
+// our builtin compiler run by builtin otherwise.
+func buildPolicy(builtin func(subcommand string) string, entrypoint, bundle, wasm, source string) []string {
+	if _, err := exec.LookPath("opa"); err == nil {
+		return opaBuildPolicy(entrypoint, bundle, wasm, source)
+	}
+
+	return []string{fmt.Sprintf(
+		"%s build -t wasm -e %s -o %s --extract %s %s",
+		builtin("opa"), entrypoint, bundle, wasm, source,
+	)}
+}
+
+// opaBuildPolicy returns the command building the rego policy with the real
+// opa and tar.
+func opaBuildPolicy(entrypoint, bundle, wasm, source string) []string {
+	return []string{
+		fmt.Sprintf("opa build -t wasm -e %s -o %s %s &&", entrypoint, bundle, source),
+		fmt.Sprintf("tar -xOf %s /policy.wasm > %s", bundle, wasm),
+	}
+}
+
+// opaCommand mimics the subset of `opa build` used by the demo, compiling
+// the policies in-process.
+func opaCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "opa",
+		Usage: "opa compatible policy build, without opa",
+		Subcommands: []*cli.Command{{
+			Name:      "build",
+			Usage:     "build a Wasm bundle from rego files",
+			ArgsUsage: "<file.rego>...",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "target",
+					Aliases: []string{"t"},
+					Usage:   "the output bundle target type",
+					Value:   "wasm",
+				},
+				&cli.StringSliceFlag{
+					Name:    "entrypoint",
+					Aliases: []string{"e"},
+					Usage:   "the entrypoints to build",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "the path of the bundle to write",
+					Value:   "bundle.tar.gz",
+				},
+				&cli.StringFlag{
+					Name:  "extract",
+					Usage: "also write the Wasm module of the bundle to this path",
+				},
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "rebuild the bundle even when it is up to date",
+				},
+			},
+			Action: opaBuild,
+		}},
+	}
+}
+
+func opaBuild(ctx *cli.Context) error {
+	if target := ctx.String("target"); target != "wasm" {
+		return errors.Errorf("unsupported target %q", target)
+	}
+	if ctx.NArg() == 0 {
+		return errors.New("at least one rego file has to be provided")
+	}
+
+	output := ctx.String("output")
+	built, err := opa.Build(context.Background(), opa.BuildOptions{
+		Entrypoints: ctx.StringSlice("entrypoint"),
+		Paths:       ctx.Args().Slice(),
+		Output:      output,
+		Force:       ctx.Bool("force"),
+	})
+	if err != nil {
+		return err
+	}
+	if !built {
+		fmt.Printf("%s is up to date, skipping the build\n", output)
+	}
+
+	if wasm := ctx.String("extract"); wasm != "" {
+		return opa.ExtractWasm(output, wasm)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/policytest"
+)
+
+// defaultSuite is the test suite of the policies shown in the demo.
+const defaultSuite = "policy-tests.yaml"
+
+func testCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "test",
+		Usage:     "check the verdicts of the policies against the request fixtures",
+		ArgsUsage: "[suite.yaml]...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "the report format: tap or junit",
+				Value:   policytest.FormatTAP,
+			},
+			&cli.PathFlag{
+				Name:  "report",
+				Usage: "write the report to this file instead of stdout",
+			},
+		},
+		Action: runTests,
+	}
+}
+
+func runTests(ctx *cli.Context) error {
+	paths := ctx.Args().Slice()
+	if len(paths) == 0 {
+		paths = []string{defaultSuite}
+	}
+
+	suites, results := []*policytest.Suite{}, [][]*policytest.Result{}
+	total, failed := 0, 0
+	for _, path := range paths {
+		s, err := policytest.Load(path)
+		if err != nil {
+			return err
+		}
+		r := s.Run(context.Background())
+		for _, result := range r {
+			if !result.Passed() {
+				failed++
+			}
+		}
+		total += len(r)
+		suites, results = append(suites, s), append(results, r)
+	}
+
+	out := os.Stdout
+	if path := ctx.Path("report"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "unable to create report")
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := policytest.Report(out, ctx.String("output"), suites, results); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d policy tests failed", failed, total)
+	}
+
+	return nil
+}
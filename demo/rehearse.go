@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+	"github.com/ereslibre/kubecon-na-21/internal/script"
+)
+
+const flagRehearse = "rehearse"
+
+// rehearsePollInterval is how often the scripts are checked for changes.
+const rehearsePollInterval = 500 * time.Millisecond
+
+func rehearseFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name: flagRehearse,
+		Usage: "watch the scripts of the runs, and reload the current run when " +
+			"they change, between two steps",
+	}
+}
+
+// rehearsal watches the scripts and reloads the active run.
+type rehearsal struct {
+	once sync.Once
+
+	mu   sync.Mutex
+	run  *demo.Run
+	name string
+}
+
+var rehearser = &rehearsal{}
+
+// rehearse makes the run reload when its script changes, starting to watch
+// the scripts on the first run.
+func rehearse(ctx *cli.Context, r *demo.Run) error {
+	if !ctx.Bool(flagRehearse) {
+		return nil
+	}
+	if info, err := os.Stat(scriptsDir); err != nil || !info.IsDir() {
+		return errors.Errorf(
+			"rehearsing needs the %s directory in the current directory, it is not possible with the embedded scripts",
+			scriptsDir,
+		)
+	}
+
+	rehearser.mu.Lock()
+	rehearser.run, rehearser.name = r, runScripts[r].Name
+	rehearser.mu.Unlock()
+	rehearser.once.Do(func() {
+		go rehearser.watch()
+	})
+
+	return nil
+}
+
+func (h *rehearsal) watch() {
+	last := scriptsState()
+	for range time.Tick(rehearsePollInterval) {
+		state := scriptsState()
+		if state == last {
+			continue
+		}
+		last = state
+		h.reload()
+	}
+}
+
+func (h *rehearsal) reload() {
+	h.mu.Lock()
+	r, name := h.run, h.name
+	h.mu.Unlock()
+
+	scripts, err := script.Load(os.DirFS(scriptsDir), scriptsDir, scriptRuntime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, color.Red.Sprintf("\nNot reloading, the scripts are invalid:\n%v", err))
+		return
+	}
+	for _, s := range scripts {
+		if s.Name != name {
+			continue
+		}
+		next, err := s.Run(scriptRuntime)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, color.Red.Sprintf("\nNot reloading %s: %v", s.Path, err))
+			return
+		}
+		r.Reload(next)
+		return
+	}
+	fmt.Fprintln(os.Stderr, color.Red.Sprintf("\nNot reloading, no script defines the %s run anymore", name))
+}
+
+// scriptsState summarizes the names, sizes and modification times of the
+// scripts, to find out when they change.
+func scriptsState() string {
+	state := ""
+	paths, _ := fs.Glob(os.DirFS(scriptsDir), "*.yaml")
+	for _, p := range paths {
+		info, err := os.Stat(filepath.Join(scriptsDir, p))
+		if err != nil {
+			continue
+		}
+		state += fmt.Sprintf("%s:%d:%d\n", p, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return state
+}
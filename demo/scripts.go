@@ -0,0 +1,100 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/ereslibre/kubecon-na-21/internal/demo"
+	"github.com/ereslibre/kubecon-na-21/internal/script"
+)
+
+// scriptsDir is the directory of the scripts describing the runs.
+const scriptsDir = "scripts"
+
+// embeddedScripts are used when the scripts are not found in the current
+// directory, so that the demo runs from anywhere.
+//
+//go:embed scripts
+var embeddedScripts embed.FS
+
+// scriptRuntime provides the functions and hooks the scripts refer to.
+var scriptRuntime = &script.Runtime{
+	Funcs: scriptFuncs(builtin),
+	Hooks: map[string]func() error{
+		"create-namespace": createNamespace,
+		"cleanup-session":  cleanupSession,
+	},
+	Shell: func(command string) error {
+		cmd := exec.Command("bash", "-c", command)
+		cmd.Dir = workDir()
+		cmd.Env = append(os.Environ(), sessionEnv()...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	},
+	Track: track,
+}
+
+// selfPlaceholder stands for the demo binary in the commands shown by show,
+// its path depends on where the demo runs.
+const selfPlaceholder = "<self>"
+
+// displayRuntime renders the commands of the scripts for show, the same ones
+// the runs execute, except for our builtin subcommands being run by
+// selfPlaceholder, as the path of the demo binary depends on where it runs.
+var displayRuntime = &script.Runtime{
+	Funcs: scriptFuncs(func(subcommand string) string {
+		return selfPlaceholder + " " + subcommand
+	}),
+	Hooks: scriptRuntime.Hooks,
+	Shell: scriptRuntime.Shell,
+	Track: scriptRuntime.Track,
+}
+
+// scriptFuncs returns the functions the scripts refer to, with our builtin
+// subcommands run by builtin.
+func scriptFuncs(builtin func(subcommand string) string) template.FuncMap {
+	return template.FuncMap{
+		"builtin": builtin,
+		"kwctl":   func() string { return kwctl(builtin) },
+		"buildPolicy": func(entrypoint, bundle, wasm, source string) string {
+			return strings.Join(buildPolicy(builtin, entrypoint, bundle, wasm, source), "\n")
+		},
+	}
+}
+
+// runScripts maps the runs to the script describing them.
+var runScripts = map[*demo.Run]*script.Script{}
+
+// loadScripts loads the scripts of the runs, from the scripts directory when
+// the demo is started from the source tree, so that they can be changed
+// without building it again.
+func loadScripts() ([]*script.Script, error) {
+	if info, err := os.Stat(scriptsDir); err == nil && info.IsDir() {
+		return script.Load(os.DirFS(scriptsDir), scriptsDir, scriptRuntime)
+	}
+	embedded, err := fs.Sub(embeddedScripts, scriptsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return script.Load(embedded, scriptsDir, scriptRuntime)
+}
+
+// addRuns adds a run to the demo for every script.
+func addRuns(d *demo.Demo, scripts []*script.Script) error {
+	for _, s := range scripts {
+		r, err := s.Run(scriptRuntime)
+		if err != nil {
+			return err
+		}
+		r.SetSideEffects(mutatingCommand)
+		d.Add(r, s.Name+" demo", s.Usage)
+		runScripts[r] = s
+	}
+
+	return nil
+}
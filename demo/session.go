@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flagDryRunCleanup = "dry-run-cleanup"
+
+	// sessionLabel is the label set on every object created by the demo,
+	// with the session ID as value.
+	sessionLabel = "kubecon-na-21.kubewarden.io/session"
+
+	// demoNamespace is the namespace the demo creates its objects in.
+	demoNamespace = "kubecon-na-21"
+)
+
+// The kinds of objects the demo creates.
+var trackedKinds = []string{
+	"ingresses.networking.k8s.io",
+	"clusteradmissionpolicies.policies.kubewarden.io",
+	"namespaces",
+}
+
+var (
+	sessionID     = newSessionID()
+	sessionDir    string
+	dryRunCleanup bool
+)
+
+func newSessionID() string {
+	b := make([]byte, 4)
+	rand.Read(b) // nolint: errcheck
+
+	return fmt.Sprintf("%x", b)
+}
+
+// createSessionDir creates the directory the step commands use as their
+// HOME and cache, so that the caches of the presenter, like the kwctl policy
+// store, are left alone. The assets are extracted into its work directory,
+// where the step commands run.
+func createSessionDir() error {
+	if sessionDir != "" {
+		return nil
+	}
+	dir, err := ioutil.TempDir("", "kubecon-na-21-session-")
+	if err != nil {
+		return errors.Wrap(err, "unable to create session directory")
+	}
+	for _, sub := range []string{"home", "cache", "work"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o700); err != nil {
+			os.RemoveAll(dir)
+			return errors.Wrap(err, "unable to create session directory")
+		}
+	}
+	if err := extractAssets(filepath.Join(dir, "work")); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	sessionDir = dir
+
+	return nil
+}
+
+func removeSessionDir() error {
+	if sessionDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(sessionDir)
+	sessionDir = ""
+
+	return errors.Wrap(err, "unable to remove session directory")
+}
+
+// sessionEnv returns the environment variables pointing the step commands to
+// the session directory. The configuration of the presenter is still used.
+func sessionEnv() []string {
+	env := []string{
+		"HOME=" + filepath.Join(sessionDir, "home"),
+		"XDG_CACHE_HOME=" + filepath.Join(sessionDir, "cache"),
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return env
+	}
+	if os.Getenv("KUBECONFIG") == "" {
+		env = append(env, "KUBECONFIG="+filepath.Join(home, ".kube", "config"))
+	}
+	if os.Getenv("XDG_CONFIG_HOME") == "" {
+		env = append(env, "XDG_CONFIG_HOME="+filepath.Join(home, ".config"))
+	}
+
+	return env
+}
+
+// workDir returns the directory the step commands run in.
+func workDir() string {
+	return filepath.Join(sessionDir, "work")
+}
+
+func sessionSelector() string {
+	return sessionLabel + "=" + sessionID
+}
+
+func dryRunCleanupFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  flagDryRunCleanup,
+		Usage: "print the objects the cleanup would delete, without deleting them",
+	}
+}
+
+// kubectl returns the kubectl command run with the session environment, like
+// the step commands, so that it talks to the same cluster.
+func kubectl(args ...string) *exec.Cmd {
+	cmd := exec.Command("kubectl", args...)
+	cmd.Env = append(os.Environ(), sessionEnv()...)
+
+	return cmd
+}
+
+// track labels the objects defined in the manifest with the session ID, so
+// that they are removed on cleanup.
+func track(manifest string) func() error {
+	return func() error {
+		cmd := kubectl("label", "--overwrite", "-f", manifest, sessionSelector())
+		cmd.Dir = workDir()
+		return cmd.Run()
+	}
+}
+
+// createNamespace creates the namespace of the demo and tracks it. An already
+// existing namespace is used as is, and is left alone on cleanup.
+func createNamespace() error {
+	out, err := kubectl("create", "namespace", demoNamespace).CombinedOutput()
+	if err != nil {
+		if !strings.Contains(string(out), "AlreadyExists") {
+			return errors.Errorf(
+				"unable to create namespace %s: %s", demoNamespace, strings.TrimSpace(string(out)),
+			)
+		}
+		fmt.Printf("Namespace %s already exists, it will not be removed on cleanup\n", demoNamespace)
+		return nil
+	}
+
+	return kubectl("label", "namespace", demoNamespace, sessionSelector()).Run()
+}
+
+// cleanupSession deletes every object labeled with the session ID, listing
+// them as they are removed.
+func cleanupSession() error {
+	header := "Removing the objects of session %s\n"
+	if dryRunCleanup {
+		header = "Objects of session %s that would be removed\n"
+	}
+	fmt.Printf(header, sessionID)
+
+	for _, kind := range trackedKinds {
+		args := []string{
+			"delete", kind, "--all-namespaces", "--ignore-not-found", "-l", sessionSelector(),
+		}
+		if dryRunCleanup {
+			args = append(args, "--dry-run=client")
+		}
+		cmd := kubectl(args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// writeTable writes the rows aligned in columns, like tabwriter does, with the
+// cells colored by colorize. The cells are colored after the alignment, the
+// escape sequences do not take any room on the terminal.
+func writeTable(w io.Writer, rows [][]string, colorize func(row, column int, cell string) string) error {
+	widths := []int{}
+	for _, row := range rows {
+		for j, cell := range row {
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	b := &strings.Builder{}
+	for i, row := range rows {
+		for j, cell := range row {
+			padding := ""
+			if j < len(row)-1 {
+				padding = strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)+2)
+			}
+			b.WriteString(colorize(i, j, cell) + padding)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}